@@ -4,33 +4,124 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	esb "github.com/dnsge/twitch-eventsub-bindings"
 )
 
 const (
-	EventSubSubscriptionsEndpoint = "https://api.twitch.tv/helix/eventsub/subscriptions"
+	// HelixBaseURL is the base URL of the Twitch API used by a SubClient
+	// unless another is given to NewSubClientURL.
+	HelixBaseURL = "https://api.twitch.tv/helix"
+
+	EventSubSubscriptionsEndpoint = HelixBaseURL + subscriptionsPath
+	EventSubConduitsEndpoint      = HelixBaseURL + conduitsPath
+	EventSubConduitShardsEndpoint = HelixBaseURL + conduitShardsPath
+
+	subscriptionsPath = "/eventsub/subscriptions"
+	conduitsPath      = "/eventsub/conduits"
+	conduitShardsPath = "/eventsub/conduits/shards"
 
 	pageSize = "100"
 )
 
+const (
+	TransportWebhook   = "webhook"
+	TransportWebSocket = "websocket"
+	TransportConduit   = "conduit"
+)
+
 type SubRequest struct {
 	// The type of event being subscribed to.
 	Type string
 	// The parameters under which the event will be fired.
 	Condition interface{}
+	// The transport method. If empty, TransportWebSocket is used if SessionID
+	// is set, TransportConduit is used if ConduitID is set, and
+	// TransportWebhook is used otherwise.
+	Method string
 	// The Webhook HTTP callback address.
 	Callback string
 	// The HMAC secret used to verify the event data.
 	Secret string
+	// The WebSocket session ID.
+	SessionID string
+	// The ID of the conduit to send notifications to.
+	ConduitID string
 	// The subscription type version.
 	Version string
 }
 
+// transport validates the transport fields and returns the request transport.
+func (srq *SubRequest) transport() (*requestTransport, error) {
+	method := srq.Method
+	if method == "" {
+		if srq.SessionID != "" {
+			method = TransportWebSocket
+		} else if srq.ConduitID != "" {
+			method = TransportConduit
+		} else {
+			method = TransportWebhook
+		}
+	}
+
+	switch method {
+	case TransportWebhook:
+		if srq.SessionID != "" || srq.ConduitID != "" {
+			return nil, errors.New("webhook transport does not use a session id or conduit id")
+		}
+		return &requestTransport{
+			Method:   method,
+			Callback: srq.Callback,
+			Secret:   srq.Secret,
+		}, nil
+	case TransportWebSocket:
+		if srq.SessionID == "" {
+			return nil, errors.New("websocket transport requires a session id")
+		} else if srq.Callback != "" || srq.Secret != "" || srq.ConduitID != "" {
+			return nil, errors.New("websocket transport does not use a callback, secret or conduit id")
+		}
+		return &requestTransport{
+			Method:    method,
+			SessionID: srq.SessionID,
+		}, nil
+	case TransportConduit:
+		if srq.ConduitID == "" {
+			return nil, errors.New("conduit transport requires a conduit id")
+		} else if srq.Callback != "" || srq.Secret != "" || srq.SessionID != "" {
+			return nil, errors.New("conduit transport does not use a callback, secret or session id")
+		}
+		return &requestTransport{
+			Method:    method,
+			ConduitID: srq.ConduitID,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport method %q", method)
+	}
+}
+
+// subscriptionRequest is the body of a create subscription request.
+type subscriptionRequest struct {
+	Type      string           `json:"type"`
+	Version   string           `json:"version"`
+	Condition interface{}      `json:"condition"`
+	Transport requestTransport `json:"transport"`
+}
+
+type requestTransport struct {
+	Method    string `json:"method"`
+	Callback  string `json:"callback,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ConduitID string `json:"conduit_id,omitempty"`
+}
+
 type Status string
 
 const (
@@ -43,6 +134,15 @@ const (
 	StatusModeratorRemoved     Status = "moderator_removed"
 	StatusUserRemoved          Status = "user_removed"
 	StatusVersionRemoved       Status = "version_removed"
+	StatusBetaMaintenance      Status = "beta_maintenance"
+
+	StatusWebSocketDisconnected           Status = "websocket_disconnected"
+	StatusWebSocketFailedPingPong         Status = "websocket_failed_ping_pong"
+	StatusWebSocketReceivedInboundTraffic Status = "websocket_received_inbound_traffic"
+	StatusWebSocketConnectionUnused       Status = "websocket_connection_unused"
+	StatusWebSocketInternalError          Status = "websocket_internal_error"
+	StatusWebSocketNetworkTimeout         Status = "websocket_network_timeout"
+	StatusWebSocketNetworkError           Status = "websocket_network_error"
 )
 
 // TwitchError describes an error from the Twitch API.
@@ -71,6 +171,7 @@ func (t *TwitchError) Error() string {
 type SubClient struct {
 	httpClient  *http.Client
 	credentials Credentials
+	baseURL     string
 }
 
 // NewSubClient creates a new SubClient with the given Credentials provider.
@@ -80,36 +181,79 @@ func NewSubClient(credentials Credentials) *SubClient {
 			Timeout: time.Second * 3,
 		},
 		credentials: credentials,
+		baseURL:     HelixBaseURL,
 	}
 }
 
 // NewSubClientHTTP creates a new SubClient with the given Credentials provider
 // and http.Client instance.
 func NewSubClientHTTP(credentials Credentials, client *http.Client) *SubClient {
+	return NewSubClientURL(credentials, client, HelixBaseURL)
+}
+
+// NewSubClientURL creates a new SubClient with the given Credentials provider
+// and http.Client instance which sends requests to the Twitch API at baseURL
+// instead of HelixBaseURL, such as a mock server from the eventsubtest
+// package.
+func NewSubClientURL(credentials Credentials, client *http.Client, baseURL string) *SubClient {
 	return &SubClient{
 		httpClient:  client,
 		credentials: credentials,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
 	}
 }
 
+// endpoint returns the URL of the API endpoint at path.
+func (s *SubClient) endpoint(path string) string {
+	return s.baseURL + path
+}
+
 // Performs a given http.Request while adding the Client-ID and Authorization
-// headers to the request.
+// headers to the request. The app token is used, unless it is empty and the
+// credentials provide a user token.
 //
 // If the returned error is non-nil, the caller must  close the returned
 // response body. The returned response is guaranteed to have a 2xx status code.
 func (s *SubClient) do(req *http.Request) (*http.Response, error) {
-	clientID, err := s.credentials.ClientID()
+	appToken, err := s.credentials.AppToken()
 	if err != nil {
-		return nil, fmt.Errorf("get client id: %w", err)
+		return nil, fmt.Errorf("get app token: %w", err)
 	}
 
-	appToken, err := s.credentials.AppToken()
+	if appToken == "" {
+		if _, ok := s.credentials.(UserCredentials); ok {
+			return s.doUser(req)
+		}
+	}
+
+	return s.doWithToken(req, appToken)
+}
+
+// Performs a given http.Request like do, but using the user token.
+func (s *SubClient) doUser(req *http.Request) (*http.Response, error) {
+	userCredentials, ok := s.credentials.(UserCredentials)
+	if !ok {
+		return nil, errors.New("get user token: credentials do not implement UserCredentials")
+	}
+
+	userToken, err := userCredentials.UserToken()
 	if err != nil {
-		return nil, fmt.Errorf("get app token: %w", err)
+		return nil, fmt.Errorf("get user token: %w", err)
+	} else if userToken == "" {
+		return nil, errors.New("get user token: user token is empty")
+	}
+
+	return s.doWithToken(req, userToken)
+}
+
+func (s *SubClient) doWithToken(req *http.Request, token string) (*http.Response, error) {
+	clientID, err := s.credentials.ClientID()
+	if err != nil {
+		return nil, fmt.Errorf("get client id: %w", err)
 	}
 
 	req.Header.Set("Client-ID", clientID)
-	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
 	if req.Body != nil && req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
@@ -132,35 +276,74 @@ func (s *SubClient) do(req *http.Request) (*http.Response, error) {
 	return res, nil
 }
 
-// Subscribe creates a new Webhook subscription.
+// Performs a JSON request with the app token. If body is non-nil, it is
+// encoded as the request body. If out is non-nil, the response body is
+// decoded into it.
+func (s *SubClient) doJSON(ctx context.Context, method, url string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+		reqBody = buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Subscribe creates a new subscription.
+//
+// Subscriptions using the WebSocket transport are created with the user token
+// of the client's UserCredentials.
 func (s *SubClient) Subscribe(ctx context.Context, srq *SubRequest) (*esb.RequestStatus, error) {
 	// set default version to 1, so we can omit that parameter in request for backward compatibility
 	if srq.Version == "" {
 		srq.Version = "1"
 	}
 
-	reqJSON := esb.Request{
+	transport, err := srq.transport()
+	if err != nil {
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+
+	reqJSON := subscriptionRequest{
 		Type:      srq.Type,
 		Version:   srq.Version,
 		Condition: srq.Condition,
-		Transport: esb.Transport{
-			Method:   "webhook",
-			Callback: srq.Callback,
-			Secret:   srq.Secret,
-		},
+		Transport: *transport,
 	}
 
 	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(reqJSON)
+	err = json.NewEncoder(buf).Encode(reqJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", EventSubSubscriptionsEndpoint, buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint(subscriptionsPath), buf)
 	if err != nil {
 		return nil, err
 	}
-	res, err := s.do(req)
+
+	var res *http.Response
+	if transport.Method == TransportWebSocket {
+		res, err = s.doUser(req)
+	} else {
+		res, err = s.do(req)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -175,11 +358,11 @@ func (s *SubClient) Subscribe(ctx context.Context, srq *SubRequest) (*esb.Reques
 	return &statusResponse, nil
 }
 
-// Unsubscribe deletes a Webhook subscription by the subscription's ID.
+// Unsubscribe deletes a subscription by the subscription's ID.
 func (s *SubClient) Unsubscribe(ctx context.Context, subscriptionID string) error {
-	u, err := url.Parse(EventSubSubscriptionsEndpoint)
+	u, err := url.Parse(s.endpoint(subscriptionsPath))
 	if err != nil {
-		return fmt.Errorf("unsubscribe: parse EventSubSubscriptionsEndpoint url: %w", err)
+		return fmt.Errorf("unsubscribe: parse subscriptions url: %w", err)
 	}
 
 	q := u.Query()
@@ -201,9 +384,47 @@ func (s *SubClient) Unsubscribe(ctx context.Context, subscriptionID string) erro
 	return nil
 }
 
+// SubscriptionTransport is the transport of an existing subscription.
+type SubscriptionTransport struct {
+	Method    string `json:"method"`
+	Callback  string `json:"callback,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ConduitID string `json:"conduit_id,omitempty"`
+}
+
+// ExistingSubscription is a subscription returned by the API, including its
+// transport.
+type ExistingSubscription struct {
+	esb.Subscription
+	Transport SubscriptionTransport `json:"transport"`
+}
+
+// subscriptionsResponse is a get subscriptions response whose subscriptions
+// include their transports.
+type subscriptionsResponse struct {
+	esb.RequestStatus
+	Data []ExistingSubscription `json:"data"`
+}
+
 // GetSubscriptions returns all EventSub subscriptions.
 // If statusFilter != StatusAny, it will apply the filter to the query.
 func (s *SubClient) GetSubscriptions(ctx context.Context, statusFilter Status) (*esb.RequestStatus, error) {
+	res, err := s.listSubscriptions(ctx, statusFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	status := res.RequestStatus
+	status.Data = make([]esb.Subscription, len(res.Data))
+	for i := range res.Data {
+		status.Data[i] = res.Data[i].Subscription
+	}
+	return &status, nil
+}
+
+// listSubscriptions returns all EventSub subscriptions with their transports,
+// following pagination.
+func (s *SubClient) listSubscriptions(ctx context.Context, statusFilter Status) (*subscriptionsResponse, error) {
 	firstRes, err := s.getSubscriptions(ctx, statusFilter, "")
 	if err != nil {
 		return nil, err
@@ -238,11 +459,11 @@ func (s *SubClient) GetSubscriptions(ctx context.Context, statusFilter Status) (
 }
 
 // Get the subscriptions with a specific pagination cursor
-func (s *SubClient) getSubscriptions(ctx context.Context, statusFilter Status, cursor string) (*esb.RequestStatus, error) {
+func (s *SubClient) getSubscriptions(ctx context.Context, statusFilter Status, cursor string) (*subscriptionsResponse, error) {
 	// First, construct the request url with the proper query parameters.
-	u, err := url.Parse(EventSubSubscriptionsEndpoint)
+	u, err := url.Parse(s.endpoint(subscriptionsPath))
 	if err != nil {
-		return nil, fmt.Errorf("get subscriptions: parse EventSubSubscriptionsEndpoint url: %w", err)
+		return nil, fmt.Errorf("get subscriptions: parse subscriptions url: %w", err)
 	}
 
 	q := u.Query()
@@ -268,7 +489,7 @@ func (s *SubClient) getSubscriptions(ctx context.Context, statusFilter Status, c
 
 	defer res.Body.Close()
 
-	var subscriptionsResponse esb.RequestStatus
+	var subscriptionsResponse subscriptionsResponse
 	if err := json.NewDecoder(res.Body).Decode(&subscriptionsResponse); err != nil {
 		return nil, err
 	}
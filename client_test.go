@@ -0,0 +1,124 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubRequest_transport(t *testing.T) {
+	tests := []struct {
+		name     string
+		srq      SubRequest
+		expected *requestTransport
+	}{
+		{
+			name:     "webhook",
+			srq:      SubRequest{Callback: "https://my.website/webhooks", Secret: "secret"},
+			expected: &requestTransport{Method: TransportWebhook, Callback: "https://my.website/webhooks", Secret: "secret"},
+		},
+		{
+			name:     "websocket",
+			srq:      SubRequest{SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB"},
+			expected: &requestTransport{Method: TransportWebSocket, SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB"},
+		},
+		{
+			name: "websocket with callback",
+			srq:  SubRequest{SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB", Callback: "https://my.website/webhooks"},
+		},
+		{
+			name: "websocket with secret",
+			srq:  SubRequest{Method: TransportWebSocket, SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB", Secret: "secret"},
+		},
+		{
+			name: "websocket without session id",
+			srq:  SubRequest{Method: TransportWebSocket},
+		},
+		{
+			name: "webhook with session id",
+			srq:  SubRequest{Method: TransportWebhook, Callback: "https://my.website/webhooks", SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB"},
+		},
+		{
+			name: "unknown method",
+			srq:  SubRequest{Method: "carrier pigeon"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := tt.srq.transport()
+			if tt.expected == nil {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, transport)
+			}
+		})
+	}
+}
+
+func TestSubClient_Subscribe_WebSocket(t *testing.T) {
+	var authorization string
+	var body subscriptionRequest
+	client := NewSubClientHTTP(
+		NewStaticUserCredentials("client-id", "user-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			authorization = req.Header.Get("Authorization")
+			_ = json.NewDecoder(req.Body).Decode(&body)
+			return newTestResponse(http.StatusAccepted, `{"data":[{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"enabled","type":"channel.update","version":"1","condition":{"broadcaster_user_id":"1337"},"created_at":"2023-07-19T14:56:51.616329898Z","cost":0}],"total":1,"total_cost":0,"max_total_cost":10}`)
+		}),
+	)
+
+	res, err := client.Subscribe(context.Background(), &SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer user-token", authorization)
+	assert.Equal(t, TransportWebSocket, body.Transport.Method)
+	assert.Equal(t, "AQoQILE98gtqShGmLD7AM6yJThAB", body.Transport.SessionID)
+	assert.Equal(t, "enabled", res.Data[0].Status)
+}
+
+func TestSubClient_Subscribe_WebSocketRequiresUserToken(t *testing.T) {
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			t.Error("unexpected request")
+			return newTestResponse(http.StatusInternalServerError, `{}`)
+		}),
+	)
+
+	_, err := client.Subscribe(context.Background(), &SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		SessionID: "AQoQILE98gtqShGmLD7AM6yJThAB",
+	})
+
+	assert.Error(t, err)
+}
+
+type roundTripperFunc func(req *http.Request) *http.Response
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func newTestHTTPClient(f roundTripperFunc) *http.Client {
+	return &http.Client{Transport: f}
+}
+
+func newTestResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
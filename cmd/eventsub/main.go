@@ -0,0 +1,260 @@
+// Command eventsub manages Twitch EventSub subscriptions.
+//
+// Usage:
+//
+//	eventsub <command> [flags] [args]
+//
+// The commands are:
+//
+//	list         list subscriptions
+//	subscribe    create a subscription
+//	unsubscribe  delete subscriptions by ID or filter
+//	prune        delete every subscription which can no longer be delivered
+//	trigger      send a signed notification to a webhook callback
+//	verify       send a verification challenge to a webhook callback
+//	revoke       send a revocation to a webhook callback
+//
+// The trigger, verify and revoke commands build messages with realistic
+// default payloads for local development, such as
+//
+//	eventsub trigger channel.cheer -to http://localhost:8080/webhook -secret s3cRe7s3cRe7 -set bits=500
+//
+// The client ID and tokens are read from the TWITCH_CLIENT_ID,
+// TWITCH_APP_TOKEN and TWITCH_USER_TOKEN environment variables, falling back
+// to a JSON config file with client_id, app_token, user_token and api_url
+// keys. The config file defaults to eventsub/config.json in the user config
+// directory and can be set with -config or EVENTSUB_CONFIG. The API base URL
+// can be set with -api-url or TWITCH_API_URL.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"time"
+
+	esf "github.com/dnsge/twitch-eventsub-framework"
+)
+
+// command runs a subcommand with its arguments.
+type command struct {
+	run     func(c *cli, args []string) error
+	summary string
+}
+
+var commands = map[string]command{
+	"list":        {runList, "list subscriptions"},
+	"subscribe":   {runSubscribe, "create a subscription"},
+	"unsubscribe": {runUnsubscribe, "delete subscriptions by ID or filter"},
+	"prune":       {runPrune, "delete every subscription which can no longer be delivered"},
+	"trigger":     {runTrigger, "send a signed notification to a webhook callback"},
+	"verify":      {runVerify, "send a verification challenge to a webhook callback"},
+	"revoke":      {runRevoke, "send a revocation to a webhook callback"},
+}
+
+// errUsage is returned when a command is used incorrectly, after the usage
+// has been printed.
+var errUsage = errors.New("usage")
+
+// cli holds the environment a command runs in.
+type cli struct {
+	ctx    context.Context
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(key string) string
+
+	// Set by the common flags
+	configPath string
+	apiURL     string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{
+		ctx:    ctx,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+// run runs the command named by the first argument and returns the exit code.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		c.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "eventsub: unknown command %q\n", args[0])
+		c.usage()
+		return 2
+	}
+
+	if err := cmd.run(c, args[1:]); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if errors.Is(err, errUsage) {
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(c.stderr, "eventsub %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: eventsub <command> [flags] [args]")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+}
+
+// flagSet returns a FlagSet for a command with the common flags.
+func (c *cli) flagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: eventsub %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&c.configPath, "config", "", "path of the config file")
+	fs.StringVar(&c.apiURL, "api-url", "", "base URL of the Twitch API")
+	return fs
+}
+
+// parse parses the flags of a command, returning errUsage if they are
+// invalid.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return err
+	} else if err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// usageError prints an error and the usage of a command and returns errUsage.
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), "eventsub %s: %s\n", fs.Name(), fmt.Sprintf(format, args...))
+	fs.Usage()
+	return errUsage
+}
+
+// config is the contents of the config file.
+type config struct {
+	ClientID  string `json:"client_id"`
+	AppToken  string `json:"app_token"`
+	UserToken string `json:"user_token"`
+	APIURL    string `json:"api_url"`
+}
+
+// loadConfig reads the config file, with values overridden by the
+// environment. A missing config file is only an error if its path was given.
+func (c *cli) loadConfig() (*config, error) {
+	path := c.configPath
+	if path == "" {
+		path = c.getenv("EVENTSUB_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "eventsub", "config.json")
+		}
+	}
+
+	var conf config
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			if err := json.Unmarshal(b, &conf); err != nil {
+				return nil, fmt.Errorf("read config %s: %w", path, err)
+			}
+		} else if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+	}
+
+	for key, value := range map[string]*string{
+		"TWITCH_CLIENT_ID":  &conf.ClientID,
+		"TWITCH_APP_TOKEN":  &conf.AppToken,
+		"TWITCH_USER_TOKEN": &conf.UserToken,
+		"TWITCH_API_URL":    &conf.APIURL,
+	} {
+		if env := c.getenv(key); env != "" {
+			*value = env
+		}
+	}
+	if c.apiURL != "" {
+		conf.APIURL = c.apiURL
+	}
+	return &conf, nil
+}
+
+// credentials implements esf.UserCredentials with the values of a config,
+// returning an error for a value which is not configured.
+type credentials struct {
+	conf *config
+}
+
+var _ esf.UserCredentials = credentials{}
+
+func (cr credentials) ClientID() (string, error) {
+	if cr.conf.ClientID == "" {
+		return "", errors.New("client id is not configured: set TWITCH_CLIENT_ID or client_id in the config file")
+	}
+	return cr.conf.ClientID, nil
+}
+
+// AppToken returns an empty token if only a user token is configured, so that
+// the user token is used for every request.
+func (cr credentials) AppToken() (string, error) {
+	if cr.conf.AppToken == "" && cr.conf.UserToken == "" {
+		return "", errors.New("app token is not configured: set TWITCH_APP_TOKEN or app_token in the config file")
+	}
+	return cr.conf.AppToken, nil
+}
+
+func (cr credentials) UserToken() (string, error) {
+	if cr.conf.UserToken == "" {
+		return "", errors.New("user token is not configured: set TWITCH_USER_TOKEN or user_token in the config file")
+	}
+	return cr.conf.UserToken, nil
+}
+
+// client returns a SubClient using the configured credentials and API URL.
+func (c *cli) client() (*esf.SubClient, error) {
+	conf, err := c.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := conf.APIURL
+	if baseURL == "" {
+		baseURL = esf.HelixBaseURL
+	}
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return esf.NewSubClientURL(credentials{conf}, httpClient, baseURL), nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// runCLI runs the command line against the server, if non-nil, with the given
+// environment and returns the exit code, stdout and stderr.
+func runCLI(server *eventsubtest.Server, env map[string]string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{
+		ctx:    context.Background(),
+		stdout: &stdout,
+		stderr: &stderr,
+		getenv: func(key string) string {
+			if key == "TWITCH_API_URL" && server != nil {
+				return server.URL
+			}
+			return env[key]
+		},
+	}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+var testEnv = map[string]string{
+	"TWITCH_CLIENT_ID": "client-id",
+	"TWITCH_APP_TOKEN": "app-token",
+}
+
+// subscribeConduit creates a subscription with the conduit transport, which
+// needs no verification.
+func subscribeConduit(t *testing.T, server *eventsubtest.Server, typ, broadcasterUserID string) string {
+	code, stdout, stderr := runCLI(server, testEnv,
+		"subscribe", "-type", typ, "-c", "broadcaster_user_id="+broadcasterUserID,
+		"-conduit", "conduit-id", "-output", "json")
+	if code != 0 {
+		t.Fatalf("subscribe failed: %s", stderr)
+	}
+
+	var subs []esb.Subscription
+	if err := json.Unmarshal([]byte(stdout), &subs); err != nil || len(subs) != 1 {
+		t.Fatalf("invalid subscribe output %q: %v", stdout, err)
+	}
+	return subs[0].ID
+}
+
+func TestSubscribe_Webhook(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	callback := httptest.NewServer(esf.NewSubHandler(true, []byte("s3cRe7s3cRe7")))
+	defer callback.Close()
+
+	code, stdout, stderr := runCLI(server, testEnv,
+		"subscribe", "-type", "channel.follow", "-version", "2",
+		"-condition", `{"broadcaster_user_id":"1337","moderator_user_id":"1337"}`,
+		"-callback", callback.URL, "-secret", "s3cRe7s3cRe7")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "channel.follow")
+	assert.Contains(t, stdout, "broadcaster_user_id=1337,moderator_user_id=1337")
+
+	subs := server.Subscriptions()
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, esf.StatusEnabled, subs[0].Status)
+		assert.Equal(t, "2", subs[0].Version)
+		assert.Equal(t, "s3cRe7s3cRe7", subs[0].Transport.Secret)
+	}
+}
+
+func TestSubscribe_Usage(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	code, _, stderr := runCLI(server, testEnv, "subscribe", "-c", "broadcaster_user_id=1")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-type is required")
+
+	code, _, stderr = runCLI(server, testEnv, "subscribe", "-type", "stream.online", "-conduit", "c")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "a condition is required")
+
+	code, _, stderr = runCLI(server, testEnv, "subscribe", "-type", "stream.online", "-c", "broadcaster_user_id=1")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "webhook transport requires a callback")
+	assert.Empty(t, server.Subscriptions())
+}
+
+func TestList(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	online := subscribeConduit(t, server, "stream.online", "1337")
+	offline := subscribeConduit(t, server, "stream.offline", "1337")
+	other := subscribeConduit(t, server, "stream.online", "42")
+	server.SetStatus(offline, esf.StatusAuthorizationRevoked)
+
+	code, stdout, stderr := runCLI(server, testEnv, "list")
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, 6, strings.Count(stdout, "\n")) // header, 3 rows, blank line and totals
+	assert.Contains(t, stdout, "3 shown, 3 total, cost 3/10000")
+
+	code, stdout, _ = runCLI(server, testEnv, "list", "-type", "stream.online", "-user", "1337")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, online)
+	assert.NotContains(t, stdout, other)
+	assert.NotContains(t, stdout, offline)
+
+	code, stdout, _ = runCLI(server, testEnv, "list", "-status", "authorization_revoked", "-output", "json")
+	assert.Equal(t, 0, code)
+	var subs []esb.Subscription
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &subs))
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, offline, subs[0].ID)
+	}
+
+	code, _, stderr = runCLI(server, testEnv, "list", "-output", "yaml")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "must be table or json")
+}
+
+func TestUnsubscribe(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	first := subscribeConduit(t, server, "stream.online", "1")
+	second := subscribeConduit(t, server, "stream.online", "2")
+	third := subscribeConduit(t, server, "stream.offline", "3")
+
+	code, stdout, stderr := runCLI(server, testEnv, "unsubscribe", first)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "deleted "+first+"\n", stdout)
+
+	code, stdout, _ = runCLI(server, testEnv, "unsubscribe", "-type", "stream.online", "-dry-run")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "would delete "+second+"\n", stdout)
+	assert.Len(t, server.Subscriptions(), 2)
+
+	code, _, _ = runCLI(server, testEnv, "unsubscribe", "-user", "2")
+	assert.Equal(t, 0, code)
+	if subs := server.Subscriptions(); assert.Len(t, subs, 1) {
+		assert.Equal(t, third, subs[0].ID)
+	}
+
+	code, _, stderr = runCLI(server, testEnv, "unsubscribe", "missing-id")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "1 of 1 deletions failed")
+
+	code, _, _ = runCLI(server, testEnv, "unsubscribe")
+	assert.Equal(t, 2, code)
+	code, _, _ = runCLI(server, testEnv, "unsubscribe", "-type", "stream.offline", third)
+	assert.Equal(t, 2, code)
+}
+
+func TestPrune(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	enabled := subscribeConduit(t, server, "stream.online", "1")
+	var failed []string
+	for i, status := range []esf.Status{
+		esf.StatusVerificationFailed,
+		esf.StatusFailuresExceeded,
+		esf.StatusAuthorizationRevoked,
+		esf.StatusUserRemoved,
+	} {
+		id := subscribeConduit(t, server, "stream.online", string(rune('2'+i)))
+		server.SetStatus(id, status)
+		failed = append(failed, id)
+	}
+
+	code, stdout, _ := runCLI(server, testEnv, "prune", "-dry-run")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, len(failed), strings.Count(stdout, "would delete"))
+	assert.Len(t, server.Subscriptions(), 5)
+
+	code, stdout, stderr := runCLI(server, testEnv, "prune")
+	assert.Equal(t, 0, code, stderr)
+	for _, id := range failed {
+		assert.Contains(t, stdout, "deleted "+id)
+	}
+	if subs := server.Subscriptions(); assert.Len(t, subs, 1) {
+		assert.Equal(t, enabled, subs[0].ID)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	// Keep the default config file from being found
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	code, _, stderr := runCLI(server, map[string]string{"TWITCH_CLIENT_ID": "client-id"}, "list")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "app token is not configured")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"client_id":"from-file","user_token":"user-token"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr = runCLI(server, map[string]string{"EVENTSUB_CONFIG": path}, "list")
+	assert.Equal(t, 0, code, stderr)
+
+	code, _, stderr = runCLI(server, nil, "list", "-config", filepath.Join(t.TempDir(), "missing.json"))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "read config")
+}
+
+func TestUnknownCommand(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	code, _, stderr := runCLI(server, testEnv, "frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "frobnicate"`)
+	assert.Contains(t, stderr, "prune")
+}
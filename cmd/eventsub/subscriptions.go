@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+)
+
+// filter selects subscriptions by status, type and user.
+type filter struct {
+	status string
+	typ    string
+	user   string
+}
+
+func (f *filter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.status, "status", "", "only subscriptions with this `status`, such as enabled")
+	fs.StringVar(&f.typ, "type", "", "only subscriptions of this `type`, such as channel.update")
+	fs.StringVar(&f.user, "user", "", "only subscriptions with this user `id` in their condition")
+}
+
+func (f *filter) empty() bool {
+	return f.status == "" && f.typ == "" && f.user == ""
+}
+
+func (f *filter) matches(sub *esb.Subscription) bool {
+	if f.status != "" && sub.Status != f.status {
+		return false
+	} else if f.typ != "" && sub.Type != f.typ {
+		return false
+	} else if f.user != "" {
+		for key, value := range condition(sub) {
+			if strings.HasSuffix(key, "user_id") && value == f.user {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// subscriptions returns the subscriptions matching the filter. The status is
+// filtered by the API and the rest by the client, since the API only accepts
+// one filter at a time.
+func (c *cli) subscriptions(client *esf.SubClient, f *filter) (*esb.RequestStatus, error) {
+	res, err := client.GetSubscriptions(c.ctx, esf.Status(f.status))
+	if err != nil {
+		return nil, err
+	}
+
+	matched := res.Data[:0]
+	for i := range res.Data {
+		if f.matches(&res.Data[i]) {
+			matched = append(matched, res.Data[i])
+		}
+	}
+	res.Data = matched
+	return res, nil
+}
+
+// condition returns the condition of a subscription as strings.
+func condition(sub *esb.Subscription) map[string]string {
+	values := make(map[string]string)
+	if m, ok := sub.Condition.(map[string]interface{}); ok {
+		for key, value := range m {
+			if s, ok := value.(string); ok && s != "" {
+				values[key] = s
+			}
+		}
+	}
+	return values
+}
+
+// formatCondition formats a condition as sorted key=value pairs.
+func formatCondition(sub *esb.Subscription) string {
+	values := condition(sub)
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// output is the format subscriptions are printed in.
+type output string
+
+const (
+	outputTable output = "table"
+	outputJSON  output = "json"
+)
+
+func (o *output) String() string {
+	return string(*o)
+}
+
+func (o *output) Set(value string) error {
+	switch output(value) {
+	case outputTable, outputJSON:
+		*o = output(value)
+		return nil
+	default:
+		return errors.New("must be table or json")
+	}
+}
+
+// printSubscriptions prints the subscriptions of a response. The table
+// format is followed by the totals of the response.
+func (c *cli) printSubscriptions(format output, res *esb.RequestStatus) error {
+	if format == outputJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res.Data)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tTYPE\tVERSION\tCONDITION\tCOST\tCREATED")
+	for i := range res.Data {
+		sub := &res.Data[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			sub.ID, sub.Status, sub.Type, sub.Version, formatCondition(sub), sub.Cost, sub.CreatedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(c.stdout, "\n%d shown, %d total, cost %d/%d\n",
+		len(res.Data), res.Total, res.TotalCost, res.MaxTotalCost)
+	return err
+}
+
+func runList(c *cli, args []string) error {
+	fs := c.flagSet("list", "[flags]")
+	var f filter
+	f.register(fs)
+	format := outputTable
+	fs.Var(&format, "output", "output `format`: table or json")
+	if err := parse(fs, args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return usageError(fs, "unexpected arguments")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.subscriptions(client, &f)
+	if err != nil {
+		return err
+	}
+	return c.printSubscriptions(format, res)
+}
+
+// keyValueFlag collects repeated key=value flags.
+type keyValueFlag map[string]string
+
+func (kv keyValueFlag) String() string {
+	return ""
+}
+
+func (kv keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("must be key=value")
+	}
+	kv[key] = val
+	return nil
+}
+
+func runSubscribe(c *cli, args []string) error {
+	fs := c.flagSet("subscribe", "-type type [flags]")
+	var srq esf.SubRequest
+	fs.StringVar(&srq.Type, "type", "", "subscription `type`, such as channel.update")
+	fs.StringVar(&srq.Version, "version", "1", "subscription type `version`")
+	conditionJSON := fs.String("condition", "", "condition as a JSON `object`")
+	conditionValues := make(keyValueFlag)
+	fs.Var(conditionValues, "c", "condition `key=value`, which may be repeated")
+	fs.StringVar(&srq.Method, "method", "", "transport `method`, inferred from the other transport flags if empty")
+	fs.StringVar(&srq.Callback, "callback", "", "webhook callback `url`")
+	fs.StringVar(&srq.Secret, "secret", "", "webhook `secret`")
+	fs.StringVar(&srq.SessionID, "session", "", "WebSocket session `id`")
+	fs.StringVar(&srq.ConduitID, "conduit", "", "conduit `id`")
+	format := outputTable
+	fs.Var(&format, "output", "output `format`: table or json")
+	if err := parse(fs, args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return usageError(fs, "unexpected arguments")
+	} else if srq.Type == "" {
+		return usageError(fs, "-type is required")
+	}
+
+	cond := make(map[string]string)
+	if *conditionJSON != "" {
+		if err := json.Unmarshal([]byte(*conditionJSON), &cond); err != nil {
+			return usageError(fs, "-condition must be a JSON object of strings: %v", err)
+		}
+	}
+	for key, value := range conditionValues {
+		cond[key] = value
+	}
+	if len(cond) == 0 {
+		return usageError(fs, "a condition is required")
+	}
+	srq.Condition = cond
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	res, err := client.Subscribe(c.ctx, &srq)
+	if err != nil {
+		return err
+	}
+	return c.printSubscriptions(format, res)
+}
+
+func runUnsubscribe(c *cli, args []string) error {
+	fs := c.flagSet("unsubscribe", "[flags] [id ...]")
+	var f filter
+	f.register(fs)
+	dryRun := fs.Bool("dry-run", false, "print the subscriptions which would be deleted")
+	if err := parse(fs, args); err != nil {
+		return err
+	} else if fs.NArg() == 0 && f.empty() {
+		return usageError(fs, "subscription IDs or a filter are required")
+	} else if fs.NArg() > 0 && !f.empty() {
+		return usageError(fs, "subscription IDs and a filter cannot both be given")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	ids := fs.Args()
+	if !f.empty() {
+		res, err := c.subscriptions(client, &f)
+		if err != nil {
+			return err
+		}
+		ids = subscriptionIDs(res.Data)
+	}
+	return c.unsubscribe(client, ids, *dryRun)
+}
+
+// prunable reports whether a subscription will never deliver notifications
+// again, so that it only counts towards the cost limit.
+func prunable(sub *esb.Subscription) bool {
+	switch esf.Status(sub.Status) {
+	case esf.StatusEnabled, esf.StatusVerificationPending:
+		return false
+	default:
+		return true
+	}
+}
+
+func runPrune(c *cli, args []string) error {
+	fs := c.flagSet("prune", "[flags]")
+	dryRun := fs.Bool("dry-run", false, "print the subscriptions which would be deleted")
+	if err := parse(fs, args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return usageError(fs, "unexpected arguments")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	res, err := client.GetSubscriptions(c.ctx, esf.StatusAny)
+	if err != nil {
+		return err
+	}
+
+	var pruned []esb.Subscription
+	for i := range res.Data {
+		if prunable(&res.Data[i]) {
+			pruned = append(pruned, res.Data[i])
+		}
+	}
+	return c.unsubscribe(client, subscriptionIDs(pruned), *dryRun)
+}
+
+func subscriptionIDs(subs []esb.Subscription) []string {
+	ids := make([]string, len(subs))
+	for i := range subs {
+		ids[i] = subs[i].ID
+	}
+	return ids
+}
+
+// unsubscribe deletes each subscription, reporting each deletion. Every
+// deletion is attempted even if some fail.
+func (c *cli) unsubscribe(client *esf.SubClient, ids []string, dryRun bool) error {
+	failed := 0
+	for _, id := range ids {
+		if dryRun {
+			fmt.Fprintf(c.stdout, "would delete %s\n", id)
+			continue
+		}
+
+		if err := client.Unsubscribe(c.ctx, id); err != nil {
+			fmt.Fprintf(c.stderr, "delete %s: %v\n", id, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(c.stdout, "deleted %s\n", id)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, len(ids))
+	}
+	return nil
+}
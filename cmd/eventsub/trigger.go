@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+)
+
+// maxPrintedBody is the number of bytes of a response body which are printed.
+const maxPrintedBody = 4096
+
+// messageFlags are the flags of the commands which send webhook messages.
+type messageFlags struct {
+	to        string
+	secret    string
+	version   string
+	condition keyValueFlag
+}
+
+func (mf *messageFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&mf.to, "to", "", "callback `url` to send the message to")
+	fs.StringVar(&mf.secret, "secret", "", "`secret` to sign the message with; if empty, the message is not signed")
+	fs.StringVar(&mf.version, "version", "", "subscription type `version`, the latest supported version if empty")
+	mf.condition = make(keyValueFlag)
+	fs.Var(mf.condition, "c", "subscription condition `key=value`, which may be repeated")
+}
+
+// parseInterspersed parses flags which may come before and after the
+// positional arguments, such as "trigger channel.cheer -to url", and returns
+// the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := parse(fs, args); err != nil {
+			return nil, err
+		} else if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseMessage parses the flags and subscription type of a command which
+// sends a message.
+func parseMessage(fs *flag.FlagSet, mf *messageFlags, args []string) (string, error) {
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return "", err
+	}
+	return checkMessage(fs, mf, positional)
+}
+
+// checkMessage checks that the flags and arguments of a command which sends a
+// message name a subscription type and a callback, and returns the type.
+func checkMessage(fs *flag.FlagSet, mf *messageFlags, positional []string) (string, error) {
+	if len(positional) != 1 {
+		return "", usageError(fs, "a subscription type is required")
+	} else if mf.to == "" {
+		return "", usageError(fs, "-to is required")
+	}
+	return positional[0], nil
+}
+
+func runTrigger(c *cli, args []string) error {
+	fs := c.flagSet("trigger", "type -to url [flags]")
+	var mf messageFlags
+	mf.register(fs)
+	overrides := make(keyValueFlag)
+	fs.Var(overrides, "set", "set event field `path=value`, such as bits=100 or product.sku=abc, which may be repeated")
+	list := fs.Bool("list", false, "list the subscription types with default events")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	} else if *list {
+		return c.listTypes()
+	}
+	subscriptionType, err := checkMessage(fs, &mf, positional)
+	if err != nil {
+		return err
+	}
+
+	m := eventsubtest.NewNotification(subscriptionType, mf.version)
+	if m.Event == nil {
+		return usageError(fs, "no default event for %s version %s, see eventsub trigger -list",
+			subscriptionType, m.Subscription.Version)
+	}
+	for path, value := range overrides {
+		if err := setField(m.Event, path, value); err != nil {
+			return usageError(fs, "-set %s: %v", path, err)
+		}
+	}
+
+	res, err := c.send(m, &mf)
+	if err != nil {
+		return err
+	}
+	return checkStatus(res)
+}
+
+func runVerify(c *cli, args []string) error {
+	fs := c.flagSet("verify", "type -to url [flags]")
+	var mf messageFlags
+	mf.register(fs)
+	subscriptionType, err := parseMessage(fs, &mf, args)
+	if err != nil {
+		return err
+	}
+
+	m := eventsubtest.NewVerification(subscriptionType, mf.version)
+	res, err := c.send(m, &mf)
+	if err != nil {
+		return err
+	} else if err := checkStatus(res); err != nil {
+		return err
+	} else if res.body != m.Challenge {
+		return fmt.Errorf("callback responded with %q instead of the challenge %q", res.body, m.Challenge)
+	}
+
+	fmt.Fprintln(c.stdout, "challenge echoed correctly")
+	return nil
+}
+
+func runRevoke(c *cli, args []string) error {
+	fs := c.flagSet("revoke", "type -to url [flags]")
+	var mf messageFlags
+	mf.register(fs)
+	reason := fs.String("reason", string(esf.StatusAuthorizationRevoked), "revocation `status`, such as user_removed")
+	subscriptionType, err := parseMessage(fs, &mf, args)
+	if err != nil {
+		return err
+	}
+
+	m := eventsubtest.NewRevocation(subscriptionType, mf.version, esf.Status(*reason))
+	res, err := c.send(m, &mf)
+	if err != nil {
+		return err
+	}
+	return checkStatus(res)
+}
+
+func (c *cli) listTypes() error {
+	for _, t := range eventsubtest.SubscriptionTypes() {
+		if _, err := fmt.Fprintf(c.stdout, "%s\t%s\n", t.Type, t.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// response is a response to a message.
+type response struct {
+	status     string
+	statusCode int
+	body       string
+}
+
+// send applies the flags to a message, sends it and prints the response.
+func (c *cli) send(m *eventsubtest.Message, mf *messageFlags) (*response, error) {
+	for key, value := range mf.condition {
+		m.Subscription.Condition[key] = value
+	}
+	m.Subscription.Transport.Callback = mf.to
+	if mf.secret != "" {
+		m.Secret = []byte(mf.secret)
+	}
+
+	req, err := m.NewRequest(c.ctx, mf.to)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPrintedBody))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	fmt.Fprintf(c.stdout, "sent %s %s for %s version %s\n",
+		m.MessageType, m.ID, m.Subscription.Type, m.Subscription.Version)
+	fmt.Fprintf(c.stdout, "%s %s\n", res.Proto, res.Status)
+	if len(body) > 0 {
+		fmt.Fprintf(c.stdout, "%s\n", body)
+	}
+
+	return &response{
+		status:     res.Status,
+		statusCode: res.StatusCode,
+		body:       string(body),
+	}, nil
+}
+
+// checkStatus returns an error if the callback did not accept the message.
+func checkStatus(res *response) error {
+	if res.statusCode < 200 || res.statusCode >= 300 {
+		return fmt.Errorf("callback responded with %s", res.status)
+	}
+	return nil
+}
+
+// setField sets the field at a dot-separated path of an event. A value
+// replacing a string is used as is; any other value is parsed as JSON if it
+// is valid JSON, so that numbers, booleans and objects can be set.
+func setField(event map[string]interface{}, path, value string) error {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := event[key]
+		if !ok || next == nil {
+			next = make(map[string]interface{})
+			event[key] = next
+		}
+		if event, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s is not an object", key)
+		}
+	}
+
+	key := keys[len(keys)-1]
+	if key == "" {
+		return errors.New("empty field name")
+	}
+	if _, isString := event[key].(string); isString {
+		event[key] = value
+		return nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+		event[key] = parsed
+	} else {
+		event[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "s3cRe7s3cRe7"
+
+// newCallback starts a server with a SubHandler which calls its handlers
+// before responding.
+func newCallback() (*httptest.Server, *esf.SubHandler) {
+	handler := esf.NewSubHandler(true, []byte(testSecret))
+	handler.Dispatcher = eventsubtest.SyncDispatcher{}
+	return httptest.NewServer(handler), handler
+}
+
+func TestTrigger(t *testing.T) {
+	callback, handler := newCallback()
+	defer callback.Close()
+
+	var cheers []*esb.EventChannelCheer
+	handler.HandleChannelCheer = func(h *esb.ResponseHeaders, event *esb.EventChannelCheer) {
+		cheers = append(cheers, event)
+	}
+
+	code, stdout, stderr := runCLI(nil, nil,
+		"trigger", "channel.cheer", "-to", callback.URL, "-secret", testSecret,
+		"-set", "bits=500", "-set", "user_id=42", "-set", "message=true")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "sent notification")
+	assert.Contains(t, stdout, "200 OK")
+
+	if assert.Len(t, cheers, 1) {
+		assert.Equal(t, 500, cheers[0].Bits)
+		assert.Equal(t, "42", cheers[0].UserID)
+		assert.Equal(t, "true", cheers[0].Message)
+		assert.Equal(t, "1337", cheers[0].BroadcasterUserID)
+	}
+}
+
+func TestTrigger_Rejected(t *testing.T) {
+	callback, _ := newCallback()
+	defer callback.Close()
+
+	code, stdout, stderr := runCLI(nil, nil, "trigger", "stream.online", "-to", callback.URL)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "403 Forbidden")
+	assert.Contains(t, stderr, "callback responded with 403 Forbidden")
+
+	code, _, stderr = runCLI(nil, nil, "trigger", "stream.online", "-to", callback.URL, "-set", "type.x=1")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "type is not an object")
+}
+
+func TestTrigger_Usage(t *testing.T) {
+	code, _, stderr := runCLI(nil, nil, "trigger", "-to", "http://localhost")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "a subscription type is required")
+
+	code, _, stderr = runCLI(nil, nil, "trigger", "channel.cheer")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-to is required")
+
+	code, _, stderr = runCLI(nil, nil, "trigger", "channel.unknown", "-to", "http://localhost")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "no default event for channel.unknown version 1")
+
+	code, stdout, _ := runCLI(nil, nil, "trigger", "-list")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "channel.update\t2\n")
+}
+
+func TestVerify(t *testing.T) {
+	callback, _ := newCallback()
+	defer callback.Close()
+
+	code, stdout, stderr := runCLI(nil, nil, "verify", "channel.follow", "-version", "2",
+		"-to", callback.URL, "-secret", testSecret)
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "sent webhook_callback_verification")
+	assert.Contains(t, stdout, "challenge echoed correctly")
+
+	wrong := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not the challenge"))
+	}))
+	defer wrong.Close()
+
+	code, _, stderr = runCLI(nil, nil, "verify", "channel.follow", "-to", wrong.URL, "-secret", testSecret)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, `callback responded with "not the challenge"`)
+}
+
+func TestRevoke(t *testing.T) {
+	callback, handler := newCallback()
+	defer callback.Close()
+
+	var revoked []*esb.Subscription
+	var reasons []esf.Status
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason esf.Status) {
+		revoked = append(revoked, sub)
+		reasons = append(reasons, reason)
+	}
+
+	code, _, stderr := runCLI(nil, nil, "revoke", "channel.ban", "-to", callback.URL, "-secret", testSecret,
+		"-reason", "user_removed", "-c", "broadcaster_user_id=42")
+	assert.Equal(t, 0, code, stderr)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	assert.Equal(t, []esf.Status{esf.StatusUserRemoved}, reasons)
+	if assert.Len(t, revoked, 1) {
+		assert.Equal(t, "channel.ban", revoked[0].Type)
+		assert.Equal(t, map[string]interface{}{"broadcaster_user_id": "42"}, revoked[0].Condition)
+	}
+}
@@ -0,0 +1,260 @@
+package eventsub_framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// Conduit is a group of shards that notifications are load balanced across.
+type Conduit struct {
+	// The ID of the conduit.
+	ID string `json:"id"`
+	// The number of shards in the conduit.
+	ShardCount int `json:"shard_count"`
+}
+
+// ConduitShard is a single transport of a conduit.
+type ConduitShard struct {
+	// The ID of the shard.
+	ID string `json:"id"`
+	// The status of the shard.
+	Status Status `json:"status"`
+	// The transport of the shard.
+	Transport ShardTransport `json:"transport"`
+}
+
+// ShardTransport describes the transport of a conduit shard.
+type ShardTransport struct {
+	// The transport method, either TransportWebhook or TransportWebSocket.
+	Method string `json:"method"`
+	// The Webhook HTTP callback address.
+	Callback string `json:"callback,omitempty"`
+	// The HMAC secret used to verify the event data. Only used when updating
+	// a shard.
+	Secret string `json:"secret,omitempty"`
+	// The WebSocket session ID.
+	SessionID string `json:"session_id,omitempty"`
+	// RFC3339 timestamp of when the WebSocket connection was created.
+	ConnectedAt string `json:"connected_at,omitempty"`
+	// RFC3339 timestamp of when the WebSocket connection was lost.
+	DisconnectedAt string `json:"disconnected_at,omitempty"`
+}
+
+// ShardUpdate describes a new transport for a conduit shard.
+type ShardUpdate struct {
+	// The ID of the shard to update.
+	ID string `json:"id"`
+	// The new transport of the shard.
+	Transport ShardTransport `json:"transport"`
+}
+
+// ShardUpdateError describes why a single shard failed to update.
+type ShardUpdateError struct {
+	// The ID of the shard that failed to update.
+	ID string `json:"id"`
+	// The error that occurred while updating the shard.
+	Message string `json:"message"`
+	// The error code of the error.
+	Code string `json:"code"`
+}
+
+func (e *ShardUpdateError) Error() string {
+	return fmt.Sprintf("shard %s: %s", e.ID, e.Message)
+}
+
+// ShardUpdateErrors is returned by UpdateConduitShards when some shards
+// failed to update.
+type ShardUpdateErrors []ShardUpdateError
+
+func (e ShardUpdateErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return "update conduit shards: " + strings.Join(messages, "; ")
+}
+
+// ConditionConduitShardDisabled is the condition of a conduit.shard.disabled
+// subscription.
+type ConditionConduitShardDisabled struct {
+	// Your application's client ID.
+	ClientID string `json:"client_id"`
+	// The conduit ID to receive events for. If omitted, events for all of
+	// this client's conduits are sent.
+	ConduitID string `json:"conduit_id,omitempty"`
+}
+
+// EventConduitShardDisabled is the event of a conduit.shard.disabled
+// notification.
+type EventConduitShardDisabled struct {
+	// The ID of the conduit.
+	ConduitID string `json:"conduit_id"`
+	// The ID of the disabled shard.
+	ShardID string `json:"shard_id"`
+	// The new status of the shard.
+	Status Status `json:"status"`
+	// The disabled transport.
+	Transport ShardTransport `json:"transport"`
+}
+
+type conduitsResponse struct {
+	Data []Conduit `json:"data"`
+}
+
+type conduitShardsResponse struct {
+	Data       []ConduitShard     `json:"data"`
+	Errors     []ShardUpdateError `json:"errors"`
+	Pagination *esb.Pagination    `json:"pagination"`
+}
+
+type conduitRequest struct {
+	ID         string `json:"id,omitempty"`
+	ShardCount int    `json:"shard_count"`
+}
+
+type conduitShardsRequest struct {
+	ConduitID string        `json:"conduit_id"`
+	Shards    []ShardUpdate `json:"shards"`
+}
+
+// GetConduits returns all conduits of the client.
+func (s *SubClient) GetConduits(ctx context.Context) ([]Conduit, error) {
+	var res conduitsResponse
+	if err := s.doJSON(ctx, "GET", s.endpoint(conduitsPath), nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// CreateConduit creates a new conduit with the given number of shards.
+func (s *SubClient) CreateConduit(ctx context.Context, shardCount int) (*Conduit, error) {
+	var res conduitsResponse
+	err := s.doJSON(ctx, "POST", s.endpoint(conduitsPath), &conduitRequest{ShardCount: shardCount}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return firstConduit(&res)
+}
+
+// UpdateConduit updates the number of shards of a conduit.
+func (s *SubClient) UpdateConduit(ctx context.Context, conduitID string, shardCount int) (*Conduit, error) {
+	var res conduitsResponse
+	err := s.doJSON(ctx, "PATCH", s.endpoint(conduitsPath), &conduitRequest{
+		ID:         conduitID,
+		ShardCount: shardCount,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return firstConduit(&res)
+}
+
+// DeleteConduit deletes a conduit by the conduit's ID.
+func (s *SubClient) DeleteConduit(ctx context.Context, conduitID string) error {
+	u, err := url.Parse(s.endpoint(conduitsPath))
+	if err != nil {
+		return fmt.Errorf("delete conduit: parse conduits url: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("id", conduitID)
+	u.RawQuery = q.Encode()
+
+	return s.doJSON(ctx, "DELETE", u.String(), nil, nil)
+}
+
+func firstConduit(res *conduitsResponse) (*Conduit, error) {
+	if len(res.Data) == 0 {
+		return nil, errors.New("expected conduit in response")
+	}
+	return &res.Data[0], nil
+}
+
+// GetConduitShards returns all shards of a conduit.
+// If statusFilter != StatusAny, it will apply the filter to the query.
+func (s *SubClient) GetConduitShards(
+	ctx context.Context,
+	conduitID string,
+	statusFilter Status,
+) ([]ConduitShard, error) {
+	var shards []ConduitShard
+	cursor := ""
+
+	// arbitrary number over 200, the maximum number of pages
+	for i := 0; i < 205; i++ {
+		res, err := s.getConduitShards(ctx, conduitID, statusFilter, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		shards = append(shards, res.Data...)
+
+		if res.Pagination == nil || res.Pagination.Cursor == "" {
+			// Done with all the pages
+			return shards, nil
+		} else {
+			cursor = res.Pagination.Cursor
+		}
+	}
+
+	return nil, fmt.Errorf("caught in loop while following pagination")
+}
+
+// Get the shards of a conduit with a specific pagination cursor
+func (s *SubClient) getConduitShards(
+	ctx context.Context,
+	conduitID string,
+	statusFilter Status,
+	cursor string,
+) (*conduitShardsResponse, error) {
+	u, err := url.Parse(s.endpoint(conduitShardsPath))
+	if err != nil {
+		return nil, fmt.Errorf("get conduit shards: parse conduit shards url: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("conduit_id", conduitID)
+	if statusFilter != StatusAny {
+		q.Set("status", string(statusFilter))
+	}
+	if cursor != "" {
+		q.Set("after", cursor)
+	}
+	u.RawQuery = q.Encode()
+
+	var res conduitShardsResponse
+	if err := s.doJSON(ctx, "GET", u.String(), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateConduitShards updates the transports of shards of a conduit and
+// returns the updated shards.
+//
+// If some shards failed to update, the successfully updated shards are
+// returned along with a ShardUpdateErrors error describing each failure.
+func (s *SubClient) UpdateConduitShards(
+	ctx context.Context,
+	conduitID string,
+	shards []ShardUpdate,
+) ([]ConduitShard, error) {
+	var res conduitShardsResponse
+	err := s.doJSON(ctx, "PATCH", s.endpoint(conduitShardsPath), &conduitShardsRequest{
+		ConduitID: conduitID,
+		Shards:    shards,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Errors) != 0 {
+		return res.Data, ShardUpdateErrors(res.Errors)
+	}
+	return res.Data, nil
+}
@@ -0,0 +1,101 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubClient_CreateConduit(t *testing.T) {
+	var body conduitRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			assert.Equal(t, "POST", req.Method)
+			assert.Equal(t, EventSubConduitsEndpoint, req.URL.String())
+			_ = json.NewDecoder(req.Body).Decode(&body)
+			return newTestResponse(http.StatusOK, `{"data":[{"id":"bfcfc993-26b1-b876-44d9-afe75a379dac","shard_count":5}]}`)
+		}),
+	)
+
+	conduit, err := client.CreateConduit(context.Background(), 5)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, body.ShardCount)
+	assert.Equal(t, &Conduit{ID: "bfcfc993-26b1-b876-44d9-afe75a379dac", ShardCount: 5}, conduit)
+}
+
+func TestSubClient_GetConduitShards(t *testing.T) {
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			q := req.URL.Query()
+			assert.Equal(t, "bfcfc993-26b1-b876-44d9-afe75a379dac", q.Get("conduit_id"))
+			assert.Equal(t, "enabled", q.Get("status"))
+
+			if q.Get("after") == "" {
+				return newTestResponse(http.StatusOK, `{"data":[{"id":"0","status":"enabled","transport":{"method":"webhook","callback":"https://this-is-a-callback.com"}}],"pagination":{"cursor":"abc"}}`)
+			}
+			assert.Equal(t, "abc", q.Get("after"))
+			return newTestResponse(http.StatusOK, `{"data":[{"id":"1","status":"enabled","transport":{"method":"websocket","session_id":"9fd5164a-a958-4c60-b7f4-6a7202506ca0","connected_at":"2020-11-10T14:32:18.730260295Z"}}],"pagination":{}}`)
+		}),
+	)
+
+	shards, err := client.GetConduitShards(context.Background(), "bfcfc993-26b1-b876-44d9-afe75a379dac", StatusEnabled)
+
+	assert.NoError(t, err)
+	if assert.Len(t, shards, 2) {
+		assert.Equal(t, "https://this-is-a-callback.com", shards[0].Transport.Callback)
+		assert.Equal(t, TransportWebSocket, shards[1].Transport.Method)
+		assert.Equal(t, "9fd5164a-a958-4c60-b7f4-6a7202506ca0", shards[1].Transport.SessionID)
+	}
+}
+
+func TestSubClient_UpdateConduitShards_PartialFailure(t *testing.T) {
+	var body conduitShardsRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			assert.Equal(t, "PATCH", req.Method)
+			_ = json.NewDecoder(req.Body).Decode(&body)
+			return newTestResponse(http.StatusAccepted, `{"data":[{"id":"0","status":"enabled","transport":{"method":"webhook","callback":"https://this-is-a-callback.com"}}],"errors":[{"id":"3","message":"The shard id is outside the conduit's range","code":""}]}`)
+		}),
+	)
+
+	shards, err := client.UpdateConduitShards(context.Background(), "bfcfc993-26b1-b876-44d9-afe75a379dac", []ShardUpdate{
+		{ID: "0", Transport: ShardTransport{Method: TransportWebhook, Callback: "https://this-is-a-callback.com", Secret: "s3cRe7"}},
+		{ID: "3", Transport: ShardTransport{Method: TransportWebhook, Callback: "https://this-is-a-callback.com", Secret: "s3cRe7"}},
+	})
+
+	assert.Len(t, body.Shards, 2)
+	assert.Len(t, shards, 1)
+
+	var shardErrors ShardUpdateErrors
+	if assert.True(t, errors.As(err, &shardErrors)) {
+		assert.Equal(t, ShardUpdateErrors{{ID: "3", Message: "The shard id is outside the conduit's range"}}, shardErrors)
+	}
+}
+
+func TestSubClient_Subscribe_Conduit(t *testing.T) {
+	var body subscriptionRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			_ = json.NewDecoder(req.Body).Decode(&body)
+			return newTestResponse(http.StatusAccepted, `{"data":[],"total":1,"total_cost":1,"max_total_cost":10000}`)
+		}),
+	)
+
+	_, err := client.Subscribe(context.Background(), &SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, requestTransport{Method: TransportConduit, ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac"}, body.Transport)
+}
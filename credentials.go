@@ -6,9 +6,19 @@ type Credentials interface {
 	AppToken() (string, error)
 }
 
+// UserCredentials represents a method of obtaining Twitch API client
+// credentials that include a user access token.
+//
+// Subscriptions using the WebSocket transport require a user access token.
+type UserCredentials interface {
+	Credentials
+	UserToken() (string, error)
+}
+
 type staticCredentials struct {
-	id    string
-	token string
+	id        string
+	token     string
+	userToken string
 }
 
 // NewStaticCredentials creates a Credentials instance with a fixed ClientID
@@ -23,6 +33,19 @@ func NewStaticCredentials(clientID string, appToken string) Credentials {
 	}
 }
 
+// NewStaticUserCredentials creates a UserCredentials instance with a fixed
+// ClientID string and UserToken string. The AppToken is empty, so the user
+// token is used for all requests.
+//
+// This Credentials implementation should only be used for development as the
+// user token will eventually expire and API calls will subsequently fail.
+func NewStaticUserCredentials(clientID string, userToken string) UserCredentials {
+	return &staticCredentials{
+		id:        clientID,
+		userToken: userToken,
+	}
+}
+
 func (s *staticCredentials) ClientID() (string, error) {
 	return s.id, nil
 }
@@ -30,3 +53,7 @@ func (s *staticCredentials) ClientID() (string, error) {
 func (s *staticCredentials) AppToken() (string, error) {
 	return s.token, nil
 }
+
+func (s *staticCredentials) UserToken() (string, error) {
+	return s.userToken, nil
+}
@@ -0,0 +1,220 @@
+package eventsub_framework
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// ErrShutdown is returned when a notification is received after Shutdown has
+// been called.
+var ErrShutdown = errors.New("sub handler is shut down")
+
+var errHandlerPanic = errors.New("handler panicked")
+
+// ErrTaskDropped may be returned by a Dispatcher to acknowledge a message
+// without running its task.
+var ErrTaskDropped = errors.New("task dropped")
+
+// Dispatcher runs the tasks that invoke handlers for received messages.
+//
+// If SubHandler.Dispatcher is nil, each handler is run in a new goroutine.
+type Dispatcher interface {
+	// Dispatch arranges for task to be run for the given message. If an
+	// error is returned, task must not be run, and the message is rejected
+	// with a 503 status so that Twitch delivers it again, unless the error is
+	// ErrTaskDropped.
+	Dispatch(d *Delivery, task func()) error
+}
+
+// dispatchError wraps an error returned by a Dispatcher.
+type dispatchError struct {
+	err error
+}
+
+func (e *dispatchError) Error() string {
+	return "dispatch: " + e.err.Error()
+}
+
+func (e *dispatchError) Unwrap() error {
+	return e.err
+}
+
+// dispatchState tracks running handlers so that they can be waited for.
+type dispatchState struct {
+	mu       sync.Mutex
+	shutdown bool
+	running  sync.WaitGroup
+
+	// Context given to handlers, cancelled if Shutdown times out.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *SubHandler) dispatchState() *dispatchState {
+	s.stateOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.state = &dispatchState{
+			ctx:    ctx,
+			cancel: cancel,
+		}
+	})
+	return s.state
+}
+
+// startDispatch reserves n running handlers and returns the context to give
+// them. Each handler must call finishDispatch when it returns. If the
+// SubHandler has been shut down, ErrShutdown is returned.
+func (s *SubHandler) startDispatch(n int) (context.Context, error) {
+	state := s.dispatchState()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.shutdown {
+		return nil, ErrShutdown
+	}
+	state.running.Add(n)
+	return state.ctx, nil
+}
+
+func (s *SubHandler) finishDispatch() {
+	s.dispatchState().running.Done()
+}
+
+// goCallback invokes fn in a new goroutine, and Shutdown waits for it. Panics
+// in fn are recovered and reported for the given message.
+//
+// Callbacks such as OnRevocation do not use the Dispatcher, so that they are
+// never dropped or rejected, and never delay the response to a message.
+func (s *SubHandler) goCallback(h *esb.ResponseHeaders, fn func(ctx context.Context)) error {
+	ctx, err := s.startDispatch(1)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer s.finishDispatch()
+		defer s.recoverPanic(h)
+		fn(ctx)
+	}()
+	return nil
+}
+
+// recoverPanic recovers a panic in a handler and reports it. It must be
+// deferred directly.
+func (s *SubHandler) recoverPanic(h *esb.ResponseHeaders) {
+	if recovered := recover(); recovered != nil {
+		s.reportPanic(h, recovered, debug.Stack())
+	}
+}
+
+// reportPanic reports a recovered panic to OnHandlerPanic, or logs it if
+// OnHandlerPanic is nil.
+func (s *SubHandler) reportPanic(h *esb.ResponseHeaders, recovered interface{}, stack []byte) {
+	if s.OnHandlerPanic != nil {
+		s.OnHandlerPanic(h, recovered, stack)
+	} else {
+		log.Printf(
+			"eventsub_framework: panic in handler for %s message %s (%s): %v\n%s",
+			h.MessageType, h.MessageID, h.SubscriptionType, recovered, stack,
+		)
+	}
+}
+
+func (s *SubHandler) isShutdown() bool {
+	state := s.dispatchState()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.shutdown
+}
+
+// Shutdown stops the SubHandler from accepting new messages and waits for
+// running handlers to return.
+//
+// Messages received after Shutdown is called are rejected with a 503 status,
+// so Twitch will deliver them again later. If the context expires before all
+// handlers return, the context given to handlers is cancelled and the
+// context's error is returned.
+func (s *SubHandler) Shutdown(ctx context.Context) error {
+	state := s.dispatchState()
+	state.mu.Lock()
+	state.shutdown = true
+	state.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		state.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		state.cancel()
+		return nil
+	case <-ctx.Done():
+		state.cancel()
+		return ctx.Err()
+	}
+}
+
+// runHandler invokes a handler, reporting a returned error or a recovered
+// panic. errHandlerPanic is returned if the handler panicked.
+func (s *SubHandler) runHandler(ctx context.Context, handler boundHandler, d *Delivery) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.reportPanic(d.Headers, recovered, debug.Stack())
+			err = errHandlerPanic
+		}
+	}()
+
+	if err := handler(ctx, d); err != nil {
+		if s.OnHandlerError != nil {
+			s.OnHandlerError(d.Headers, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// dispatchResult collects the results of the handlers invoked for a delivery.
+type dispatchResult struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results chan error
+	n       int
+	// Done by each handler when it returns.
+	running sync.WaitGroup
+}
+
+// wait waits for every handler to return and returns the first error. If the
+// handler context is done first, its error is returned instead. A nil
+// dispatchResult has no handlers to wait for.
+func (r *dispatchResult) wait() error {
+	if r == nil {
+		return nil
+	}
+	defer r.cancel()
+
+	var first error
+	for i := 0; i < r.n; i++ {
+		select {
+		case err := <-r.results:
+			if first == nil {
+				first = err
+			}
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+	}
+	return first
+}
+
+// waitReturned waits for every handler to return, even if wait has returned
+// because the handler context is done.
+func (r *dispatchResult) waitReturned() {
+	r.running.Wait()
+}
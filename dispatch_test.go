@@ -0,0 +1,273 @@
+package eventsub_framework
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubHandler_Shutdown(t *testing.T) {
+	started := newDispatcher(1)
+	release := make(chan struct{})
+	finished := false
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		started.Trigger()
+		<-release
+		finished = true
+		return nil
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- handler.Shutdown(context.Background())
+	}()
+
+	// Shutdown must wait for the running handler
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned before handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// New deliveries are rejected so that Twitch retries them
+	res = handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	close(release)
+	assert.NoError(t, <-shutdownErr)
+	assert.True(t, finished)
+}
+
+func TestSubHandler_Shutdown_Timeout(t *testing.T) {
+	started := newDispatcher(1)
+	cancelled := newDispatcher(1)
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		started.Trigger()
+		<-ctx.Done()
+		cancelled.Trigger()
+		return ctx.Err()
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, handler.Shutdown(ctx), context.DeadlineExceeded)
+	assert.True(t, cancelled.WaitForTrigger(100*time.Millisecond), "handler context was not cancelled")
+}
+
+func TestSubHandler_HandlerPanic(t *testing.T) {
+	recovered := newDispatcher(1)
+	var value interface{}
+	var stack []byte
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		panic("bad event")
+	}
+	handler.OnHandlerPanic = func(h *esb.ResponseHeaders, r interface{}, s []byte) {
+		value, stack = r, s
+		recovered.Trigger()
+	}
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, recovered.WaitForTrigger(100*time.Millisecond), "panic was not reported")
+	assert.Equal(t, "bad event", value)
+	assert.NotEmpty(t, stack)
+
+	// The panicking handler is still counted as finished
+	assert.NoError(t, handler.Shutdown(context.Background()))
+}
+
+func TestSubHandler_AckAfterHandle(t *testing.T) {
+	fail := true
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.IDTracker = NewMapTracker()
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		if fail {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	// The redelivery is not dropped as a duplicate
+	fail = false
+	res = handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestSubHandler_AckAfterHandle_Panic(t *testing.T) {
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.OnHandlerPanic = func(h *esb.ResponseHeaders, recovered interface{}, stack []byte) {}
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		panic("bad event")
+	}
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
+
+func TestSubHandler_AckAfterHandle_Timeout(t *testing.T) {
+	cancelled := newDispatcher(1)
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.HandleTimeout = 10 * time.Millisecond
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		<-ctx.Done()
+		cancelled.Trigger()
+		return ctx.Err()
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.True(t, cancelled.WaitForTrigger(100*time.Millisecond), "handler context was not cancelled")
+}
+
+func TestSubHandler_AckAfterHandle_TimeoutReservation(t *testing.T) {
+	started := newDispatcher(2)
+	release := make(chan struct{})
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.HandleTimeout = 10 * time.Millisecond
+	handler.IDTracker = NewTTLTracker(time.Minute, 0)
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		started.Trigger()
+		// Ignores the context, like a handler stuck in a slow call
+		<-release
+		return nil
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	// The timed out handler is still running, so the redelivery is rejected
+	// rather than handled at the same time
+	res = handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.False(t, started.WaitForTrigger(50*time.Millisecond), "redelivery was handled concurrently")
+
+	close(release)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+
+	// Released once the handler returned, so the next redelivery is handled
+	assert.Eventually(t, func() bool {
+		reserved, _ := AdaptIDTracker(handler.IDTracker).Reserve(context.Background(), "eTOJ71BBQNXGNW8qPUNMRGIHH5yv4bBrvwl02DWgF0o=")
+		return reserved
+	}, time.Second, 10*time.Millisecond, "message ID was not released")
+}
+
+func TestSubHandler_AckAfterHandle_Reservation(t *testing.T) {
+	started := newDispatcher(1)
+	release := make(chan struct{})
+	fail := true
+
+	tracker := NewTTLTracker(time.Minute, 0)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.IDTracker = tracker
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		started.Trigger()
+		<-release
+		if fail {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	first := make(chan int, 1)
+	go func() {
+		first <- handleRequest(handler, newNotificationRequest).StatusCode
+	}()
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	// A redelivery while the message is being handled is rejected, since the
+	// message may yet fail
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	close(release)
+	assert.Equal(t, http.StatusInternalServerError, <-first)
+
+	// The failed message was released, so the redelivery is handled
+	fail = false
+	res = handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "redelivery was not handled")
+
+	// Once committed, the message is a duplicate
+	reserved, _ := tracker.Reserve(context.Background(), "eTOJ71BBQNXGNW8qPUNMRGIHH5yv4bBrvwl02DWgF0o=")
+	assert.False(t, reserved)
+}
+
+// failingCommitTracker is a TTLTracker whose Commit fails, recording the
+// context it was called with.
+type failingCommitTracker struct {
+	*TTLTracker
+	ctxErr chan error
+}
+
+func (t *failingCommitTracker) Commit(ctx context.Context, _ string) error {
+	t.ctxErr <- ctx.Err()
+	return errors.New("database unavailable")
+}
+
+func TestSubHandler_IDTrackerError(t *testing.T) {
+	tracker := &failingCommitTracker{
+		TTLTracker: NewTTLTracker(time.Minute, 0),
+		ctxErr:     make(chan error, 1),
+	}
+	reported := make(chan error, 1)
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.AckAfterHandle = true
+	handler.IDTracker = tracker
+	handler.OnIDTrackerError = func(h *esb.ResponseHeaders, err error) {
+		reported <- err
+	}
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {}
+
+	// The request context is cancelled before the message ID is committed
+	ctx, cancel := context.WithCancel(context.Background())
+	res := handleRequest(handler, func() *http.Request {
+		cancel()
+		return newNotificationRequest().WithContext(ctx)
+	})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NoError(t, <-tracker.ctxErr, "message ID was committed with the request context")
+	assert.EqualError(t, <-reported, "database unavailable")
+}
@@ -0,0 +1,38 @@
+package eventsub_framework
+
+// ConditionChannelFollowV2 is the condition of a version 2 channel.follow
+// subscription.
+type ConditionChannelFollowV2 struct {
+	// The broadcaster user ID for the channel you want to get follow notifications for.
+	BroadcasterUserID string `json:"broadcaster_user_id"`
+	// The ID of the moderator of the channel you want to get follow notifications for. If you have authorization from the broadcaster rather than a moderator, specify the broadcaster's user ID here.
+	ModeratorUserID string `json:"moderator_user_id"`
+}
+
+// ConditionChannelUpdateV2 is the condition of a version 2 channel.update
+// subscription.
+type ConditionChannelUpdateV2 struct {
+	// The broadcaster user ID for the channel you want to get updates for.
+	BroadcasterUserID string `json:"broadcaster_user_id"`
+}
+
+// EventChannelUpdateV2 is the event of a version 2 channel.update
+// notification.
+type EventChannelUpdateV2 struct {
+	// The broadcaster’s user ID.
+	BroadcasterUserID string `json:"broadcaster_user_id"`
+	// The broadcaster’s user login.
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	// The broadcaster’s user display name.
+	BroadcasterUserName string `json:"broadcaster_user_name"`
+	// The channel’s stream title.
+	Title string `json:"title"`
+	// The channel’s broadcast language.
+	Language string `json:"language"`
+	// The channel’s category ID.
+	CategoryID string `json:"category_id"`
+	// The category name.
+	CategoryName string `json:"category_name"`
+	// Array of content classification label IDs currently applied on the Channel.
+	ContentClassificationLabels []string `json:"content_classification_labels"`
+}
@@ -0,0 +1,271 @@
+package eventsubtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"time"
+
+	esf "github.com/dnsge/twitch-eventsub-framework"
+)
+
+// Message types of webhook messages.
+const (
+	MessageTypeVerification = "webhook_callback_verification"
+	MessageTypeNotification = "notification"
+	MessageTypeRevocation   = "revocation"
+)
+
+// DefaultCallback is the callback of the subscription of a message built by
+// NewNotification, NewVerification or NewRevocation.
+const DefaultCallback = "https://example.com/webhooks/callback"
+
+// SubscriptionType is a subscription type and version.
+type SubscriptionType struct {
+	Type    string
+	Version string
+}
+
+// SubscriptionTypes returns every subscription type and version which has a
+// default payload, sorted by type and version. These are the types which
+// SubHandler has a HandleXXX field for.
+func SubscriptionTypes() []SubscriptionType {
+	types := make([]SubscriptionType, 0, len(payloads))
+	for t := range payloads {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Type != types[j].Type {
+			return types[i].Type < types[j].Type
+		}
+		return versionLess(types[i].Version, types[j].Version)
+	})
+	return types
+}
+
+// LatestVersion returns the latest version of a subscription type which has a
+// default payload, or "1" if the type has none.
+func LatestVersion(subscriptionType string) string {
+	latest := "1"
+	for t := range payloads {
+		if t.Type == subscriptionType && versionLess(latest, t.Version) {
+			latest = t.Version
+		}
+	}
+	return latest
+}
+
+// versionLess reports whether version a is older than version b. Numeric
+// versions are compared as numbers and are newer than non-numeric versions,
+// such as "beta", which are compared as strings.
+func versionLess(a, b string) bool {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return an < bn
+	case aErr == nil || bErr == nil:
+		return bErr == nil
+	default:
+		return a < b
+	}
+}
+
+// Message is a webhook message sent by EventSub. Every field may be changed
+// before the message is encoded by Body, Header or a request method.
+type Message struct {
+	// The Twitch-Eventsub-Message-Type header.
+	MessageType string
+	// The Twitch-Eventsub-Message-Id header.
+	ID string
+	// The Twitch-Eventsub-Message-Retry header.
+	Retry int
+	// The Twitch-Eventsub-Message-Timestamp header.
+	Timestamp time.Time
+
+	// The subscription the message is for. Its type and version are also
+	// sent as headers.
+	Subscription Subscription
+	// The event of a notification.
+	Event map[string]interface{}
+	// The challenge of a verification.
+	Challenge string
+
+	// The secret the message is signed with. If nil, the message is not
+	// signed.
+	Secret []byte
+}
+
+// NewNotification returns a notification for the given subscription type and
+// version with a realistic default event. If version is empty, the latest
+// version is used. If the type has no default payload, the condition and
+// event are empty.
+func NewNotification(subscriptionType, version string) *Message {
+	m := newMessage(MessageTypeNotification, subscriptionType, version)
+	m.Subscription.Status = esf.StatusEnabled
+	if p, ok := payloads[SubscriptionType{m.Subscription.Type, m.Subscription.Version}]; ok {
+		if err := json.Unmarshal([]byte(p.event), &m.Event); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// NewVerification returns a callback verification request for the given
+// subscription type and version, with a random challenge.
+func NewVerification(subscriptionType, version string) *Message {
+	m := newMessage(MessageTypeVerification, subscriptionType, version)
+	m.Subscription.Status = esf.StatusVerificationPending
+	m.Challenge = newID()
+	return m
+}
+
+// NewRevocation returns a revocation of a subscription of the given type and
+// version for the given reason, such as esf.StatusAuthorizationRevoked.
+func NewRevocation(subscriptionType, version string, reason esf.Status) *Message {
+	m := newMessage(MessageTypeRevocation, subscriptionType, version)
+	m.Subscription.Status = reason
+	return m
+}
+
+func newMessage(messageType, subscriptionType, version string) *Message {
+	if version == "" {
+		version = LatestVersion(subscriptionType)
+	}
+
+	condition := make(map[string]string)
+	for key, value := range payloads[SubscriptionType{subscriptionType, version}].condition {
+		condition[key] = value
+	}
+
+	now := time.Now().UTC()
+	return &Message{
+		MessageType: messageType,
+		ID:          newID(),
+		Timestamp:   now,
+		Subscription: Subscription{
+			ID:        newID(),
+			Type:      subscriptionType,
+			Version:   version,
+			Condition: condition,
+			CreatedAt: now.Format(time.RFC3339Nano),
+			Cost:      1,
+			Transport: Transport{
+				Method:   esf.TransportWebhook,
+				Callback: DefaultCallback,
+			},
+		},
+	}
+}
+
+// SetEvent replaces the event of the message with v encoded as JSON, such as
+// an event struct of the bindings package.
+func (m *Message) SetEvent(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(b, &event); err != nil {
+		return err
+	}
+	m.Event = event
+	return nil
+}
+
+// Body returns the JSON body of the message.
+func (m *Message) Body() []byte {
+	body := map[string]interface{}{
+		"subscription": m.Subscription,
+	}
+	switch m.MessageType {
+	case MessageTypeNotification:
+		body["event"] = m.Event
+	case MessageTypeVerification:
+		body["challenge"] = m.Challenge
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Header returns the headers of the message with the given body, signed with
+// the secret if there is one.
+func (m *Message) Header(body []byte) http.Header {
+	headers := http.Header{
+		"Content-Type":                                     {"application/json"},
+		"Twitch-Eventsub-Message-Id":                       {m.ID},
+		"Twitch-Eventsub-Message-Retry":                    {strconv.Itoa(m.Retry)},
+		"Twitch-Eventsub-Message-Timestamp":                {m.Timestamp.UTC().Format(time.RFC3339Nano)},
+		"Twitch-Eventsub-Message-Type":                     {m.MessageType},
+		"Twitch-Eventsub-Subscription-Is-Batching-Enabled": {"false"},
+		"Twitch-Eventsub-Subscription-Type":                {m.Subscription.Type},
+		"Twitch-Eventsub-Subscription-Version":             {m.Subscription.Version},
+	}
+	if m.Secret != nil {
+		Sign(headers, body, m.Secret)
+	}
+	return headers
+}
+
+// Request returns the message as an incoming server request, for passing to
+// a SubHandler directly.
+func (m *Message) Request() *http.Request {
+	body := m.Body()
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	req.Header = m.Header(body)
+	return req
+}
+
+// NewRequest returns the message as a request to send to the given URL.
+func (m *Message) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	body := m.Body()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = m.Header(body)
+	return req, nil
+}
+
+// Sign sets the Twitch-Eventsub-Message-Signature header of a message with
+// the given headers and body, as checked by esf.VerifyRequestSignature.
+func Sign(headers http.Header, body, secret []byte) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(headers.Get("Twitch-Eventsub-Message-Id")))
+	mac.Write([]byte(headers.Get("Twitch-Eventsub-Message-Timestamp")))
+	mac.Write(body)
+	headers.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// SyncDispatcher is an esf.Dispatcher which runs each task before returning,
+// so that a SubHandler has called its handlers by the time ServeHTTP returns.
+//
+// Callbacks such as OnRevocation do not use the Dispatcher; call
+// SubHandler.Shutdown to wait for them.
+type SyncDispatcher struct{}
+
+func (SyncDispatcher) Dispatch(_ *esf.Delivery, task func()) error {
+	task()
+	return nil
+}
+
+// Serve passes the request to the handler and returns the response. With a
+// SubHandler using SyncDispatcher, the handlers have been called once Serve
+// returns.
+func Serve(handler http.Handler, req *http.Request) *http.Response {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Result()
+}
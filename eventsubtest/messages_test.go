@@ -0,0 +1,144 @@
+package eventsubtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSyncHandler() *esf.SubHandler {
+	handler := esf.NewSubHandler(true, []byte(testSecret))
+	handler.Dispatcher = eventsubtest.SyncDispatcher{}
+	return handler
+}
+
+func TestSign(t *testing.T) {
+	m := eventsubtest.NewNotification("channel.cheer", "1")
+	body := m.Body()
+	req := m.Request()
+	eventsubtest.Sign(req.Header, body, []byte(testSecret))
+
+	valid, err := esf.VerifyRequestSignature(req, body, []byte(testSecret))
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = esf.VerifyRequestSignature(req, body, []byte("wrong secret"))
+	assert.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestNewNotification_AllTypes(t *testing.T) {
+	handler := newSyncHandler()
+	handler.OnUnknownNotification = func(h *esb.ResponseHeaders, rawSubscription, rawEvent json.RawMessage) {
+		t.Errorf("%s v%s has no handler", h.SubscriptionType, h.SubscriptionVersion)
+	}
+
+	// Set every HandleXXX field to count its calls
+	calls := 0
+	v := reflect.ValueOf(handler).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if strings.HasPrefix(v.Type().Field(i).Name, "Handle") && field.Kind() == reflect.Func {
+			field.Set(reflect.MakeFunc(field.Type(), func([]reflect.Value) []reflect.Value {
+				calls++
+				return nil
+			}))
+		}
+	}
+
+	types := eventsubtest.SubscriptionTypes()
+	assert.NotEmpty(t, types)
+	for _, typ := range types {
+		m := eventsubtest.NewNotification(typ.Type, typ.Version)
+		m.Secret = []byte(testSecret)
+		assert.NotEmpty(t, m.Subscription.Condition, typ)
+		assert.NotEmpty(t, m.Event, typ)
+
+		// Events which do not decode are rejected with 400 Bad Request
+		res := eventsubtest.Serve(handler, m.Request())
+		assert.Equal(t, http.StatusOK, res.StatusCode, typ)
+	}
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	assert.Equal(t, len(types), calls)
+}
+
+func TestNewNotification_Override(t *testing.T) {
+	handler := newSyncHandler()
+
+	var cheers []*esb.EventChannelCheer
+	handler.HandleChannelCheer = func(h *esb.ResponseHeaders, event *esb.EventChannelCheer) {
+		cheers = append(cheers, event)
+	}
+
+	m := eventsubtest.NewNotification("channel.cheer", "")
+	m.Secret = []byte(testSecret)
+	m.Event["bits"] = 5000
+	res := eventsubtest.Serve(handler, m.Request())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	err := m.SetEvent(&esb.EventChannelCheer{BroadcasterUserID: "42", Bits: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m.ID = "second-message"
+	res = eventsubtest.Serve(handler, m.Request())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The handler was called synchronously
+	if assert.Len(t, cheers, 2) {
+		assert.Equal(t, 5000, cheers[0].Bits)
+		assert.Equal(t, "1337", cheers[0].BroadcasterUserID)
+		assert.Equal(t, 1, cheers[1].Bits)
+		assert.Equal(t, "42", cheers[1].BroadcasterUserID)
+	}
+}
+
+func TestNewNotification_Unsigned(t *testing.T) {
+	handler := newSyncHandler()
+	m := eventsubtest.NewNotification("stream.online", "1")
+
+	res := eventsubtest.Serve(handler, m.Request())
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestNewNotification_LatestVersion(t *testing.T) {
+	m := eventsubtest.NewNotification("channel.update", "")
+	assert.Equal(t, "2", m.Subscription.Version)
+	assert.Contains(t, m.Event, "content_classification_labels")
+}
+
+func TestNewVerification(t *testing.T) {
+	handler := newSyncHandler()
+	m := eventsubtest.NewVerification("channel.follow", "2")
+	m.Secret = []byte(testSecret)
+
+	res := eventsubtest.Serve(handler, m.Request())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, m.Challenge, string(body))
+}
+
+func TestNewRevocation(t *testing.T) {
+	handler := newSyncHandler()
+
+	var reasons []esf.Status
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason esf.Status) {
+		reasons = append(reasons, reason)
+	}
+
+	m := eventsubtest.NewRevocation("channel.ban", "1", esf.StatusAuthorizationRevoked)
+	m.Secret = []byte(testSecret)
+	res := eventsubtest.Serve(handler, m.Request())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	assert.Equal(t, []esf.Status{esf.StatusAuthorizationRevoked}, reasons)
+}
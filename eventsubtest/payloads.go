@@ -0,0 +1,404 @@
+package eventsubtest
+
+// payload is the default condition and event of a subscription type.
+type payload struct {
+	condition map[string]string
+	event     string
+}
+
+var (
+	broadcasterCondition = map[string]string{"broadcaster_user_id": "1337"}
+	moderatorCondition   = map[string]string{"broadcaster_user_id": "1337", "moderator_user_id": "1337"}
+	chatCondition        = map[string]string{"broadcaster_user_id": "1337", "user_id": "1337"}
+)
+
+const (
+	subscribeEvent = `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"tier": "1000", "is_gift": false
+	}`
+	moderatorEvent = `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"user_id": "1234", "user_login": "mod_user", "user_name": "Mod_User"
+	}`
+	rewardEvent = `{
+		"id": "9001",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"is_enabled": true, "is_paused": false, "is_in_stock": true,
+		"title": "Cool Reward", "cost": 100, "prompt": "reward prompt",
+		"is_user_input_required": true, "should_redemptions_skip_request_queue": false,
+		"cooldown_expires_at": null, "redemptions_redeemed_current_stream": null,
+		"max_per_stream": {"is_enabled": true, "value": 1000},
+		"max_per_user_per_stream": {"is_enabled": true, "value": 1000},
+		"global_cooldown": {"is_enabled": true, "seconds": 1000},
+		"background_color": "#FA1ED2",
+		"image": {
+			"url_1x": "https://static-cdn.jtvnw.net/image-1.png",
+			"url_2x": "https://static-cdn.jtvnw.net/image-2.png",
+			"url_4x": "https://static-cdn.jtvnw.net/image-4.png"
+		},
+		"default_image": {
+			"url_1x": "https://static-cdn.jtvnw.net/default-1.png",
+			"url_2x": "https://static-cdn.jtvnw.net/default-2.png",
+			"url_4x": "https://static-cdn.jtvnw.net/default-4.png"
+		}
+	}`
+	redemptionEvent = `{
+		"id": "17fa2df1-ad76-4804-bfa5-a40ef63efe63",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"user_id": "9001", "user_login": "cooler_user", "user_name": "Cooler_User",
+		"user_input": "pogchamp", "status": "unfulfilled",
+		"reward": {"id": "92af127c-7326-4483-a52b-b0da0be61c01", "title": "title", "cost": 100, "prompt": "reward prompt"},
+		"redeemed_at": "2020-07-15T17:16:03.17106713Z"
+	}`
+	pollEvent = `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"choices": [
+			{"id": "123", "title": "Yeah!", "bits_votes": 5, "channel_points_votes": 7, "votes": 12},
+			{"id": "124", "title": "No!", "bits_votes": 10, "channel_points_votes": 4, "votes": 14},
+			{"id": "125", "title": "Maybe!", "bits_votes": 0, "channel_points_votes": 7, "votes": 7}
+		],
+		"bits_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"channel_points_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"ends_at": "2020-07-15T17:16:08.17106713Z"
+	}`
+	predictionEvent = `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"outcomes": [
+			{
+				"id": "1243456", "title": "Yeah!", "color": "blue", "users": 10, "channel_points": 15000,
+				"top_predictors": [
+					{"user_id": "3333", "user_login": "cool_user", "user_name": "Cool_User", "channel_points_won": null, "channel_points_used": 500}
+				]
+			},
+			{
+				"id": "2243456", "title": "No!", "color": "pink", "users": 3, "channel_points": 5000,
+				"top_predictors": [
+					{"user_id": "4444", "user_login": "cooler_user", "user_name": "Cooler_User", "channel_points_won": null, "channel_points_used": 1000}
+				]
+			}
+		],
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"locks_at": "2020-07-15T17:21:03.17106713Z"
+	}`
+	goalEvent = `{
+		"id": "12345-cool-event",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"type": "subscription", "description": "Help me get partner!",
+		"current_amount": 100, "target_amount": 220,
+		"started_at": "2021-07-15T17:16:03.17106713Z"
+	}`
+	hypeTrainEvent = `{
+		"id": "1b0AsbInCHZW2SQFQkCzqN07Ib2",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"total": 137, "progress": 137, "goal": 500, "level": 2,
+		"top_contributions": [
+			{"user_id": "123", "user_login": "pogchamp", "user_name": "PogChamp", "type": "bits", "total": 50},
+			{"user_id": "456", "user_login": "kappa", "user_name": "Kappa", "type": "subscription", "total": 45}
+		],
+		"last_contribution": {"user_id": "123", "user_login": "pogchamp", "user_name": "PogChamp", "type": "bits", "total": 50},
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"expires_at": "2020-07-15T17:16:11.17106713Z"
+	}`
+	userAuthorizationEvent = `{
+		"client_id": "crq72vsaoijkc83xx42hz6i37",
+		"user_id": "1337", "user_login": "cool_user", "user_name": "Cool_User"
+	}`
+)
+
+// payloads contains the default payload of each subscription type and version
+// which SubHandler has a HandleXXX field for. The events are based on the
+// examples in the Twitch EventSub reference.
+var payloads = map[SubscriptionType]payload{
+	{"channel.update", "1"}: {broadcasterCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Best Stream Ever", "language": "en",
+		"category_id": "12453", "category_name": "Grand Theft Auto", "is_mature": false
+	}`},
+	{"channel.update", "2"}: {broadcasterCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Best Stream Ever", "language": "en",
+		"category_id": "12453", "category_name": "Grand Theft Auto",
+		"content_classification_labels": ["MatureGame"]
+	}`},
+	{"channel.follow", "1"}: {broadcasterCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"followed_at": "2020-07-15T18:16:11.17106713Z"
+	}`},
+	{"channel.follow", "2"}: {moderatorCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"followed_at": "2020-07-15T18:16:11.17106713Z"
+	}`},
+	{"channel.subscribe", "1"}:        {broadcasterCondition, subscribeEvent},
+	{"channel.subscription.end", "1"}: {broadcasterCondition, subscribeEvent},
+	{"channel.subscription.gift", "1"}: {broadcasterCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"total": 2, "tier": "1000", "cumulative_total": 284, "is_anonymous": false
+	}`},
+	{"channel.subscription.message", "1"}: {broadcasterCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"tier": "1000",
+		"message": {"text": "Love the stream! FevziGG", "emotes": [{"begin": 23, "end": 30, "id": "302976485"}]},
+		"cumulative_months": 15, "streak_months": 1, "duration_months": 6
+	}`},
+	{"channel.cheer", "1"}: {broadcasterCondition, `{
+		"is_anonymous": false,
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"message": "pogchamp", "bits": 1000
+	}`},
+	{"channel.raid", "1"}: {map[string]string{"to_broadcaster_user_id": "1337"}, `{
+		"from_broadcaster_user_id": "1234", "from_broadcaster_user_login": "cool_user", "from_broadcaster_user_name": "Cool_User",
+		"to_broadcaster_user_id": "1337", "to_broadcaster_user_login": "cooler_user", "to_broadcaster_user_name": "Cooler_User",
+		"viewers": 9001
+	}`},
+	{"channel.ban", "1"}: {broadcasterCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"moderator_user_id": "1339", "moderator_user_login": "mod_user", "moderator_user_name": "Mod_User",
+		"reason": "Offensive language",
+		"banned_at": "2020-07-15T18:15:11.17106713Z", "ends_at": "2020-07-15T18:16:11.17106713Z",
+		"is_permanent": false
+	}`},
+	{"channel.unban", "1"}: {broadcasterCondition, `{
+		"user_id": "1234", "user_login": "cool_user", "user_name": "Cool_User",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cooler_user", "broadcaster_user_name": "Cooler_User",
+		"moderator_user_id": "1339", "moderator_user_login": "mod_user", "moderator_user_name": "Mod_User"
+	}`},
+	{"channel.unban_request.create", "1"}: {moderatorCondition, `{
+		"id": "60",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"user_id": "1339", "user_login": "not_cool_user", "user_name": "Not_Cool_User",
+		"text": "unban me", "created_at": "2023-11-16T20:15:13.130226719Z"
+	}`},
+	{"channel.unban_request.resolve", "1"}: {moderatorCondition, `{
+		"id": "60",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"moderator_user_id": "1337", "moderator_user_login": "cool_user", "moderator_user_name": "Cool_User",
+		"user_id": "1339", "user_login": "not_cool_user", "user_name": "Not_Cool_User",
+		"resolution_text": "no", "status": "denied"
+	}`},
+	{"channel.moderator.add", "1"}:                               {broadcasterCondition, moderatorEvent},
+	{"channel.moderator.remove", "1"}:                            {broadcasterCondition, moderatorEvent},
+	{"channel.channel_points_custom_reward.add", "1"}:            {broadcasterCondition, rewardEvent},
+	{"channel.channel_points_custom_reward.update", "1"}:         {broadcasterCondition, rewardEvent},
+	{"channel.channel_points_custom_reward.remove", "1"}:         {broadcasterCondition, rewardEvent},
+	{"channel.channel_points_custom_reward_redemption.add", "1"}: {broadcasterCondition, redemptionEvent},
+	{"channel.channel_points_custom_reward_redemption.update", "1"}: {broadcasterCondition, `{
+		"id": "17fa2df1-ad76-4804-bfa5-a40ef63efe63",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"user_id": "9001", "user_login": "cooler_user", "user_name": "Cooler_User",
+		"user_input": "pogchamp", "status": "fulfilled",
+		"reward": {"id": "92af127c-7326-4483-a52b-b0da0be61c01", "title": "title", "cost": 100, "prompt": "reward prompt"},
+		"redeemed_at": "2020-07-15T17:16:03.17106713Z"
+	}`},
+	{"channel.poll.begin", "1"}: {broadcasterCondition, `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"choices": [{"id": "123", "title": "Yeah!"}, {"id": "124", "title": "No!"}, {"id": "125", "title": "Maybe!"}],
+		"bits_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"channel_points_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"ends_at": "2020-07-15T17:16:08.17106713Z"
+	}`},
+	{"channel.poll.progress", "1"}: {broadcasterCondition, pollEvent},
+	{"channel.poll.end", "1"}: {broadcasterCondition, `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"choices": [
+			{"id": "123", "title": "Blue", "bits_votes": 50, "channel_points_votes": 70, "votes": 120},
+			{"id": "124", "title": "Yellow", "bits_votes": 100, "channel_points_votes": 40, "votes": 140},
+			{"id": "125", "title": "Green", "bits_votes": 10, "channel_points_votes": 70, "votes": 80}
+		],
+		"bits_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"channel_points_voting": {"is_enabled": true, "amount_per_vote": 10},
+		"status": "completed",
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"ended_at": "2020-07-15T17:16:11.17106713Z"
+	}`},
+	{"channel.prediction.begin", "1"}: {broadcasterCondition, `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"outcomes": [
+			{"id": "1243456", "title": "Yeah!", "color": "blue"},
+			{"id": "2243456", "title": "No!", "color": "pink"}
+		],
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"locks_at": "2020-07-15T17:21:03.17106713Z"
+	}`},
+	{"channel.prediction.progress", "1"}: {broadcasterCondition, predictionEvent},
+	{"channel.prediction.lock", "1"}: {broadcasterCondition, `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"outcomes": [
+			{
+				"id": "1243456", "title": "Yeah!", "color": "blue", "users": 10, "channel_points": 15000,
+				"top_predictors": [
+					{"user_id": "3333", "user_login": "cool_user", "user_name": "Cool_User", "channel_points_won": null, "channel_points_used": 500}
+				]
+			},
+			{
+				"id": "2243456", "title": "No!", "color": "pink", "users": 3, "channel_points": 5000,
+				"top_predictors": [
+					{"user_id": "4444", "user_login": "cooler_user", "user_name": "Cooler_User", "channel_points_won": null, "channel_points_used": 1000}
+				]
+			}
+		],
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"locked_at": "2020-07-15T17:21:03.17106713Z"
+	}`},
+	{"channel.prediction.end", "1"}: {broadcasterCondition, `{
+		"id": "1243456",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"title": "Aren't shoes just really hard socks?",
+		"winning_outcome_id": "12345",
+		"outcomes": [
+			{
+				"id": "12345", "title": "Yeah!", "color": "blue", "users": 2, "channel_points": 15000,
+				"top_predictors": [
+					{"user_id": "3333", "user_login": "cool_user", "user_name": "Cool_User", "channel_points_won": 10000, "channel_points_used": 500}
+				]
+			},
+			{
+				"id": "22435", "title": "No!", "color": "pink", "users": 2, "channel_points": 200,
+				"top_predictors": [
+					{"user_id": "4444", "user_login": "cooler_user", "user_name": "Cooler_User", "channel_points_won": null, "channel_points_used": 100}
+				]
+			}
+		],
+		"status": "resolved",
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"ended_at": "2020-07-15T17:16:11.17106713Z"
+	}`},
+	{"drop.entitlement.grant", "1"}: {map[string]string{"organization_id": "9001", "category_id": "9002"}, `{
+		"id": "bf7c8577-e3e6-4a6b-b3c0-1ecf4e0c4f04",
+		"data": [
+			{
+				"organization_id": "9001", "category_id": "9002", "category_name": "Fortnite",
+				"campaign_id": "9003",
+				"user_id": "1234", "user_name": "Cool_User", "user_login": "cool_user",
+				"entitlement_id": "fb78259e-fb81-4d1b-8333-34a06ffc24c0",
+				"benefit_id": "74c52265-e214-48a6-91b9-23b6014e8041",
+				"created_at": "2019-01-28T04:17:53.325Z"
+			}
+		]
+	}`},
+	{"extension.bits_transaction.create", "1"}: {map[string]string{"extension_client_id": "deadbeef"}, `{
+		"id": "bits-tx-id",
+		"extension_client_id": "deadbeef",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"user_id": "1236", "user_login": "coolest_user", "user_name": "Coolest_User",
+		"product": {"name": "great_product", "sku": "skuskusku", "bits": 1234, "in_development": false}
+	}`},
+	{"channel.goal.begin", "1"}:    {broadcasterCondition, goalEvent},
+	{"channel.goal.progress", "1"}: {broadcasterCondition, goalEvent},
+	{"channel.goal.end", "1"}: {broadcasterCondition, `{
+		"id": "12345-abc-678-defgh",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"type": "subscription", "description": "Help me get partner!",
+		"is_achieved": false, "current_amount": 180, "target_amount": 220,
+		"started_at": "2021-07-15T17:16:03.17106713Z",
+		"ended_at": "2020-07-16T17:16:03.17106713Z"
+	}`},
+	{"channel.hype_train.begin", "1"}:    {broadcasterCondition, hypeTrainEvent},
+	{"channel.hype_train.progress", "1"}: {broadcasterCondition, hypeTrainEvent},
+	{"channel.hype_train.end", "1"}: {broadcasterCondition, `{
+		"id": "1b0AsbInCHZW2SQFQkCzqN07Ib2",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"level": 2, "total": 137,
+		"top_contributions": [
+			{"user_id": "123", "user_login": "pogchamp", "user_name": "PogChamp", "type": "bits", "total": 50},
+			{"user_id": "456", "user_login": "kappa", "user_name": "Kappa", "type": "subscription", "total": 45}
+		],
+		"started_at": "2020-07-15T17:16:03.17106713Z",
+		"ended_at": "2020-07-15T17:16:11.17106713Z",
+		"cooldown_ends_at": "2020-07-15T18:16:11.17106713Z"
+	}`},
+	{"stream.online", "1"}: {broadcasterCondition, `{
+		"id": "9001",
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"type": "live", "started_at": "2020-10-11T10:11:12.123Z"
+	}`},
+	{"stream.offline", "1"}: {broadcasterCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User"
+	}`},
+	{"user.authorization.grant", "1"}:  {map[string]string{"client_id": "crq72vsaoijkc83xx42hz6i37"}, userAuthorizationEvent},
+	{"user.authorization.revoke", "1"}: {map[string]string{"client_id": "crq72vsaoijkc83xx42hz6i37"}, userAuthorizationEvent},
+	{"user.update", "1"}: {map[string]string{"user_id": "1337"}, `{
+		"user_id": "1337", "user_login": "cool_user", "user_name": "Cool_User",
+		"email": "user@email.com", "email_verified": true, "description": "cool description"
+	}`},
+	{"channel.chat.message", "1"}: {chatCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"chatter_user_id": "4145994", "chatter_user_login": "viewer32", "chatter_user_name": "viewer32",
+		"message_id": "cc106a89-1814-919d-454c-f4f2f970aae7",
+		"message": {
+			"text": "Hi chat",
+			"fragments": [{"type": "text", "text": "Hi chat", "cheermote": null, "emote": null, "mention": null}]
+		},
+		"color": "#00FF7F",
+		"badges": [{"set_id": "moderator", "id": "1", "info": ""}],
+		"message_type": "text",
+		"cheer": null, "reply": null, "channel_points_custom_reward_id": null
+	}`},
+	{"channel.chat.clear", "1"}: {chatCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User"
+	}`},
+	{"channel.chat.clear_user_messages", "1"}: {chatCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"target_user_id": "7734", "target_user_login": "uncool_viewer", "target_user_name": "Uncool_viewer"
+	}`},
+	{"channel.chat.message_delete", "1"}: {chatCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"target_user_id": "7734", "target_user_login": "uncool_viewer", "target_user_name": "Uncool_viewer",
+		"message_id": "ab24e0b0-2260-4bac-94e4-05eedd4ecd0e"
+	}`},
+	{"channel.chat.notification", "1"}: {chatCondition, `{
+		"broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "broadcaster_user_name": "Cool_User",
+		"chatter_user_id": "444", "chatter_user_login": "cool_chatter", "chatter_user_name": "Cool_Chatter",
+		"chatter_is_anonymous": false,
+		"color": "red",
+		"badges": [{"set_id": "moderator", "id": "1", "info": ""}],
+		"system_message": "Cool_Chatter subscribed at Tier 1. They've subscribed for 10 months!",
+		"message_id": "ab24e0b0-2260-4bac-94e4-05eedd4ecd0e",
+		"message": {
+			"text": "chat-msg",
+			"fragments": [{"type": "text", "text": "chat-msg", "cheermote": null, "emote": null, "mention": null}]
+		},
+		"notice_type": "resub",
+		"sub": null,
+		"resub": {
+			"cumulative_months": 10, "duration_months": 0, "streak_months": null,
+			"sub_tier": "1000", "is_prime": false, "is_gift": false,
+			"gifter_is_anonymous": null, "gifter_user_id": null, "gifter_user_name": null, "gifter_user_login": null
+		},
+		"sub_gift": null, "community_sub_gift": null, "gift_paid_upgrade": null, "prime_paid_upgrade": null,
+		"pay_it_forward": null, "raid": null, "unraid": null, "announcement": null,
+		"bits_badge_tier": null, "charity_donation": null
+	}`},
+	{"conduit.shard.disabled", "1"}: {map[string]string{"client_id": "uo6dggojyb8d6soh92zknwmi5ej1q2"}, `{
+		"conduit_id": "bfcfc993-26b1-b876-44d9-afe75a379dac",
+		"shard_id": "4",
+		"status": "websocket_disconnected",
+		"transport": {
+			"method": "websocket",
+			"session_id": "ad1c9fc3-0d99-4eb7-8a04-8608e8ff9ec9",
+			"connected_at": "2020-11-10T14:32:18.730260295Z",
+			"disconnected_at": "2020-11-11T14:32:18.730260295Z"
+		}
+	}`},
+}
@@ -0,0 +1,496 @@
+// Package eventsubtest provides a mock of the Twitch EventSub API for testing
+// EventSub applications offline.
+package eventsubtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	esf "github.com/dnsge/twitch-eventsub-framework"
+)
+
+const (
+	// DefaultMaxTotalCost is the default subscription cost limit of a Server.
+	DefaultMaxTotalCost = 10000
+	// DefaultPageSize is the default number of subscriptions a Server returns
+	// per page.
+	DefaultPageSize = 100
+)
+
+// Transport is the transport of a subscription.
+type Transport struct {
+	Method    string `json:"method"`
+	Callback  string `json:"callback,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ConduitID string `json:"conduit_id,omitempty"`
+
+	// The secret used to sign webhook messages, which the API never returns.
+	Secret string `json:"-"`
+}
+
+// Subscription is a subscription held by a Server.
+type Subscription struct {
+	ID        string            `json:"id"`
+	Status    esf.Status        `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	CreatedAt string            `json:"created_at"`
+	Cost      int               `json:"cost"`
+	Transport Transport         `json:"transport"`
+}
+
+// createRequest is the body of a create subscription request.
+type createRequest struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport struct {
+		Method    string `json:"method"`
+		Callback  string `json:"callback"`
+		Secret    string `json:"secret"`
+		SessionID string `json:"session_id"`
+		ConduitID string `json:"conduit_id"`
+	} `json:"transport"`
+}
+
+// subscriptionsResponse is the body of a create or get subscriptions response.
+type subscriptionsResponse struct {
+	Data         []Subscription `json:"data"`
+	Total        int            `json:"total"`
+	TotalCost    int            `json:"total_cost"`
+	MaxTotalCost int            `json:"max_total_cost"`
+	Pagination   struct {
+		Cursor string `json:"cursor,omitempty"`
+	} `json:"pagination"`
+}
+
+// Server is a mock of the Twitch EventSub subscriptions API.
+//
+// Creating a subscription with the webhook transport performs the callback
+// verification handshake before the response is sent, so the subscription is
+// either enabled or has failed verification once SubClient.Subscribe returns.
+// As with Twitch, the response still reports that verification is pending.
+//
+// Requests must have Client-Id and Authorization headers, but their values
+// are not checked.
+type Server struct {
+	// The base URL of the mock API, for use with esf.NewSubClientURL.
+	URL string
+
+	// The maximum total cost of all subscriptions.
+	MaxTotalCost int
+	// Cost returns the cost of a new subscription. If nil, each subscription
+	// costs 1.
+	Cost func(sub *Subscription) int
+	// The maximum number of subscriptions returned per page.
+	PageSize int
+	// Client used to send messages to webhook callbacks.
+	Client *http.Client
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	server *httptest.Server
+
+	mu   sync.Mutex
+	subs []*Subscription // in order of creation
+}
+
+// NewServer starts a new Server. Close must be called when it is no longer
+// needed.
+func NewServer() *Server {
+	s := &Server{
+		MaxTotalCost: DefaultMaxTotalCost,
+		PageSize:     DefaultPageSize,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// Subscriptions returns every subscription held by the server, in order of
+// creation.
+func (s *Server) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]Subscription, len(s.subs))
+	for i, sub := range s.subs {
+		subs[i] = *sub
+	}
+	return subs
+}
+
+// Subscription returns the subscription with the given ID.
+func (s *Server) Subscription(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub := s.find(id); sub != nil {
+		return *sub, true
+	}
+	return Subscription{}, false
+}
+
+// SetStatus sets the status of the subscription with the given ID, returning
+// false if there is no such subscription.
+func (s *Server) SetStatus(id string, status esf.Status) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub := s.find(id); sub != nil {
+		sub.Status = status
+		return true
+	}
+	return false
+}
+
+func (s *Server) find(id string) *Subscription {
+	for _, sub := range s.subs {
+		if sub.ID == id {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Notify sends a notification with the given event for a webhook subscription
+// to its callback and returns the response. The caller must close the
+// response body.
+func (s *Server) Notify(ctx context.Context, subscriptionID string, event interface{}) (*http.Response, error) {
+	sub, ok := s.Subscription(subscriptionID)
+	if !ok {
+		return nil, fmt.Errorf("no subscription with id %q", subscriptionID)
+	} else if sub.Transport.Method != esf.TransportWebhook {
+		return nil, fmt.Errorf("subscription %q does not use the webhook transport", subscriptionID)
+	}
+
+	m := s.message(MessageTypeNotification, &sub)
+	if err := m.SetEvent(event); err != nil {
+		return nil, err
+	}
+	return s.send(ctx, m)
+}
+
+// message returns a message for a subscription, signed with its secret.
+func (s *Server) message(messageType string, sub *Subscription) *Message {
+	return &Message{
+		MessageType:  messageType,
+		ID:           newID(),
+		Timestamp:    s.now(),
+		Subscription: *sub,
+		Secret:       []byte(sub.Transport.Secret),
+	}
+}
+
+// send sends a webhook message to the callback of its subscription.
+func (s *Server) send(ctx context.Context, m *Message) (*http.Response, error) {
+	req, err := m.NewRequest(ctx, m.Subscription.Transport.Callback)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.Do(req)
+}
+
+// verify performs the callback verification handshake for a webhook
+// subscription, returning whether the callback echoed the challenge.
+func (s *Server) verify(ctx context.Context, sub *Subscription) bool {
+	m := s.message(MessageTypeVerification, sub)
+	m.Challenge = newID()
+
+	res, err := s.send(ctx, m)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	echo, err := io.ReadAll(res.Body)
+	return err == nil && res.StatusCode >= 200 && res.StatusCode < 300 && string(echo) == m.Challenge
+}
+
+// newID returns a random UUID.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/eventsub/subscriptions" {
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+	if r.Header.Get("Client-Id") == "" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized, "missing client id or token")
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.create(w, r)
+	case "GET":
+		s.list(w, r)
+	case "DELETE":
+		s.delete(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "")
+	}
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+
+	sub := &Subscription{
+		ID:        newID(),
+		Status:    esf.StatusEnabled,
+		Type:      req.Type,
+		Version:   req.Version,
+		Condition: req.Condition,
+		CreatedAt: s.now().UTC().Format(time.RFC3339Nano),
+		Cost:      1,
+		Transport: Transport{
+			Method:    req.Transport.Method,
+			Callback:  req.Transport.Callback,
+			SessionID: req.Transport.SessionID,
+			ConduitID: req.Transport.ConduitID,
+			Secret:    req.Transport.Secret,
+		},
+	}
+	if err := validate(sub); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.Cost != nil {
+		sub.Cost = s.Cost(sub)
+	}
+	if sub.Transport.Method == esf.TransportWebhook {
+		sub.Status = esf.StatusVerificationPending
+	}
+
+	s.mu.Lock()
+	for _, existing := range s.subs {
+		if existing.Type == sub.Type && existing.Version == sub.Version &&
+			reflect.DeepEqual(existing.Condition, sub.Condition) &&
+			existing.Transport == sub.Transport {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, "subscription already exists")
+			return
+		}
+	}
+	if total, _ := s.totals(); total+sub.Cost > s.MaxTotalCost {
+		s.mu.Unlock()
+		writeError(w, http.StatusTooManyRequests, "subscription limit exceeded")
+		return
+	}
+	s.subs = append(s.subs, sub)
+	created := *sub
+	s.mu.Unlock()
+
+	if sub.Transport.Method == esf.TransportWebhook {
+		status := esf.StatusVerificationFailed
+		if s.verify(r.Context(), &created) {
+			status = esf.StatusEnabled
+		}
+		s.SetStatus(sub.ID, status)
+	}
+
+	s.mu.Lock()
+	res := subscriptionsResponse{
+		Data:         []Subscription{created},
+		Total:        len(s.subs),
+		MaxTotalCost: s.MaxTotalCost,
+	}
+	res.TotalCost, _ = s.totals()
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, &res)
+}
+
+// validate checks the fields of a new subscription.
+func validate(sub *Subscription) error {
+	if sub.Type == "" || sub.Version == "" {
+		return errors.New("type and version are required")
+	} else if len(sub.Condition) == 0 {
+		return errors.New("condition is required")
+	}
+
+	t := sub.Transport
+	switch t.Method {
+	case esf.TransportWebhook:
+		if t.Callback == "" {
+			return errors.New("webhook transport requires a callback")
+		} else if len(t.Secret) < 10 || len(t.Secret) > 100 {
+			return errors.New("webhook secret must be between 10 and 100 characters")
+		}
+	case esf.TransportWebSocket:
+		if t.SessionID == "" {
+			return errors.New("websocket transport requires a session id")
+		}
+	case esf.TransportConduit:
+		if t.ConduitID == "" {
+			return errors.New("conduit transport requires a conduit id")
+		}
+	default:
+		return fmt.Errorf("unknown transport method %q", t.Method)
+	}
+	return nil
+}
+
+// totals returns the total cost and number of subscriptions. s.mu must be
+// held.
+func (s *Server) totals() (cost, count int) {
+	for _, sub := range s.subs {
+		cost += sub.Cost
+	}
+	return cost, len(s.subs)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filters := 0
+	for _, key := range []string{"status", "type", "user_id"} {
+		if q.Get(key) != "" {
+			filters++
+		}
+	}
+	if filters > 1 {
+		writeError(w, http.StatusBadRequest, "only one of status, type and user_id may be given")
+		return
+	}
+
+	pageSize := s.PageSize
+	if first := q.Get("first"); first != "" {
+		n, err := strconv.Atoi(first)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "first must be between 1 and 100")
+			return
+		}
+		if n < pageSize {
+			pageSize = n
+		}
+	}
+
+	offset := 0
+	if after := q.Get("after"); after != "" {
+		n, err := strconv.Atoi(after)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		offset = n
+	}
+
+	s.mu.Lock()
+	var matched []Subscription
+	for _, sub := range s.subs {
+		if matches(sub, q.Get("status"), q.Get("type"), q.Get("user_id")) {
+			matched = append(matched, *sub)
+		}
+	}
+	res := subscriptionsResponse{
+		Data:         []Subscription{},
+		Total:        len(s.subs),
+		MaxTotalCost: s.MaxTotalCost,
+	}
+	res.TotalCost, _ = s.totals()
+	s.mu.Unlock()
+
+	if offset < len(matched) {
+		end := offset + pageSize
+		if end < len(matched) {
+			res.Pagination.Cursor = strconv.Itoa(end)
+		} else {
+			end = len(matched)
+		}
+		res.Data = matched[offset:end]
+	}
+
+	writeJSON(w, http.StatusOK, &res)
+}
+
+// matches returns whether a subscription matches the non-empty filters.
+func matches(sub *Subscription, status, subscriptionType, userID string) bool {
+	if status != "" && string(sub.Status) != status {
+		return false
+	} else if subscriptionType != "" && sub.Type != subscriptionType {
+		return false
+	} else if userID != "" {
+		for key, value := range sub.Condition {
+			if strings.HasSuffix(key, "user_id") && value == userID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sub := range s.subs {
+		if sub.ID == id {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "subscription not found")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of the Twitch API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &esf.TwitchError{
+		ErrorText: http.StatusText(status),
+		Status:    status,
+		Message:   message,
+	})
+}
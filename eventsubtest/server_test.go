@@ -0,0 +1,183 @@
+package eventsubtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "s3cRe7s3cRe7"
+
+func newTestClient(server *eventsubtest.Server) *esf.SubClient {
+	return esf.NewSubClientURL(
+		esf.NewStaticCredentials("client-id", "app-token"),
+		http.DefaultClient,
+		server.URL,
+	)
+}
+
+func webhookRequest(callback, broadcasterUserID string) *esf.SubRequest {
+	return &esf.SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": broadcasterUserID},
+		Callback:  callback,
+		Secret:    testSecret,
+	}
+}
+
+func TestServer_SubscribeVerifyNotify(t *testing.T) {
+	ctx := context.Background()
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	updates := make(chan *esb.EventChannelUpdate, 1)
+	handler := esf.NewSubHandler(true, []byte(testSecret))
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		updates <- event
+	}
+	callback := httptest.NewServer(handler)
+	defer callback.Close()
+
+	client := newTestClient(server)
+	res, err := client.Subscribe(ctx, webhookRequest(callback.URL, "1337"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, string(esf.StatusVerificationPending), res.Data[0].Status)
+	assert.Equal(t, 1, res.TotalCost)
+
+	sub, _ := server.Subscription(res.Data[0].ID)
+	assert.Equal(t, esf.StatusEnabled, sub.Status)
+
+	notifyRes, err := server.Notify(ctx, sub.ID, &esb.EventChannelUpdate{
+		BroadcasterUserID: "1337",
+		Title:             "hello there!",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_ = notifyRes.Body.Close()
+	assert.Equal(t, http.StatusOK, notifyRes.StatusCode)
+
+	select {
+	case event := <-updates:
+		assert.Equal(t, "hello there!", event.Title)
+	case <-time.After(time.Second):
+		t.Fatal("notification was not handled")
+	}
+}
+
+func TestServer_VerificationFailed(t *testing.T) {
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	handler := esf.NewSubHandler(true, []byte(testSecret))
+	handler.VerifyChallenge = func(h *esb.ResponseHeaders, chal *esb.SubscriptionChallenge) bool {
+		return false
+	}
+	callback := httptest.NewServer(handler)
+	defer callback.Close()
+
+	res, err := newTestClient(server).Subscribe(context.Background(), webhookRequest(callback.URL, "1337"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sub, _ := server.Subscription(res.Data[0].ID)
+	assert.Equal(t, esf.StatusVerificationFailed, sub.Status)
+}
+
+func TestServer_Conflict(t *testing.T) {
+	ctx := context.Background()
+	server := eventsubtest.NewServer()
+	defer server.Close()
+
+	client := newTestClient(server)
+	srq := &esf.SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+	}
+	_, err := client.Subscribe(ctx, srq)
+	assert.NoError(t, err)
+
+	_, err = client.Subscribe(ctx, srq)
+	var twitchErr *esf.TwitchError
+	if assert.True(t, errors.As(err, &twitchErr)) {
+		assert.Equal(t, http.StatusConflict, twitchErr.Status)
+	}
+}
+
+func TestServer_CostLimit(t *testing.T) {
+	ctx := context.Background()
+	server := eventsubtest.NewServer()
+	server.MaxTotalCost = 1
+	defer server.Close()
+
+	client := newTestClient(server)
+	_, err := client.Subscribe(ctx, &esf.SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Subscribe(ctx, &esf.SubRequest{
+		Type:      "channel.update",
+		Condition: map[string]string{"broadcaster_user_id": "42"},
+		ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+	})
+	var twitchErr *esf.TwitchError
+	if assert.True(t, errors.As(err, &twitchErr)) {
+		assert.Equal(t, http.StatusTooManyRequests, twitchErr.Status)
+	}
+}
+
+func TestServer_ListAndUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	server := eventsubtest.NewServer()
+	server.PageSize = 2
+	defer server.Close()
+
+	client := newTestClient(server)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		_, err := client.Subscribe(ctx, &esf.SubRequest{
+			Type:      "channel.update",
+			Condition: map[string]string{"broadcaster_user_id": id},
+			ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+		})
+		assert.NoError(t, err)
+	}
+	subs := server.Subscriptions()
+	server.SetStatus(subs[1].ID, esf.StatusAuthorizationRevoked)
+
+	// Followed across pages
+	res, err := client.GetSubscriptions(ctx, esf.StatusAny)
+	assert.NoError(t, err)
+	assert.Len(t, res.Data, 5)
+	assert.Equal(t, 5, res.Total)
+	assert.Equal(t, 5, res.TotalCost)
+
+	res, err = client.GetSubscriptions(ctx, esf.StatusAuthorizationRevoked)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Data, 1) {
+		assert.Equal(t, subs[1].ID, res.Data[0].ID)
+	}
+
+	assert.NoError(t, client.Unsubscribe(ctx, subs[1].ID))
+	assert.Len(t, server.Subscriptions(), 4)
+
+	err = client.Unsubscribe(ctx, subs[1].ID)
+	var twitchErr *esf.TwitchError
+	if assert.True(t, errors.As(err, &twitchErr)) {
+		assert.Equal(t, http.StatusNotFound, twitchErr.Status)
+	}
+}
@@ -0,0 +1,19 @@
+package eventsubtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionLess(t *testing.T) {
+	assert.True(t, versionLess("1", "2"))
+	assert.True(t, versionLess("2", "10"))
+	assert.False(t, versionLess("10", "2"))
+	assert.False(t, versionLess("2", "2"))
+
+	// Numeric versions are newer than non-numeric versions
+	assert.True(t, versionLess("beta", "1"))
+	assert.False(t, versionLess("1", "beta"))
+	assert.True(t, versionLess("alpha", "beta"))
+}
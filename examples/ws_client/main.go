@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"log"
+)
+
+const (
+	// These are usually created by your application automatically
+	clientID  = `abc123`
+	userToken = `def456`
+)
+
+func main() {
+	subClient := esf.NewSubClient(esf.NewStaticUserCredentials(clientID, userToken))
+
+	handler := esf.NewSubHandler(false, nil)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		fmt.Println("Got a channel.update notification!")
+		fmt.Printf("Message id: %s\n", h.MessageID)
+		fmt.Printf("Channel: %s Title: %s\n", event.BroadcasterUserName, event.Title)
+	}
+
+	client := esf.NewWSClient(handler)
+	client.OnWelcome = func(session *esf.WSSession) {
+		fmt.Printf("Connected with session id: %s\n", session.ID)
+
+		// Subscriptions must be created for each new session
+		_, err := subClient.Subscribe(context.Background(), &esf.SubRequest{
+			Type: "channel.update",
+			Condition: esb.ConditionChannelUpdate{
+				BroadcasterUserID: "22484632",
+			},
+			SessionID: session.ID,
+		})
+		if err != nil {
+			log.Printf("Failed to subscribe: %v\n", err)
+		}
+	}
+
+	err := client.Run(context.Background())
+	if err != nil {
+		log.Fatalf("WebSocket session ended: %v\n", err)
+	}
+}
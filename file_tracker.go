@@ -0,0 +1,337 @@
+package eventsub_framework
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileTrackerCompactMin is the number of records a FileTracker file may hold
+// before it is compacted automatically.
+const fileTrackerCompactMin = 1024
+
+var errFileTrackerClosed = errors.New("file tracker is closed")
+
+// FileTracker is a ReservingIDTracker which persists IDs to an append-only
+// file so that duplicates are still detected after a restart. IDs expire after
+// the TTL.
+//
+// Each ID is appended to the file as a single line. A line that was only
+// partly written when the process died is ignored when the file is opened.
+// Appends are not synced to disk, so IDs survive the process crashing but may
+// be lost if the machine crashes. Close syncs the file.
+//
+// The file is compacted to remove expired and removed IDs when it is opened,
+// when Compact is called, and once it holds more than 1024 records, either
+// when it grows to twice the number of IDs held or when the TTL has passed
+// since it was last compacted. Compaction writes a temporary file which
+// replaces the original, so the file is never left incomplete.
+type FileTracker struct {
+	path string
+	ttl  time.Duration
+
+	// How long a reservation is held before it expires.
+	ReservationTTL time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File // nil if it must be reopened
+	closed  bool
+	entries   map[string]fileEntry
+	records   int       // number of records in file
+	compacted time.Time // when the file was last compacted
+}
+
+type fileEntry struct {
+	expires  time.Time
+	reserved bool
+}
+
+// fileRecord is a line of a FileTracker file. A zero Expires records that the
+// ID was removed.
+type fileRecord struct {
+	ID       string `json:"id"`
+	Expires  int64  `json:"expires,omitempty"` // Unix nanoseconds
+	Reserved bool   `json:"reserved,omitempty"`
+}
+
+// NewFileTracker opens the FileTracker file at path, creating it if it does
+// not exist, and loads the IDs which have not expired.
+func NewFileTracker(path string, ttl time.Duration) (*FileTracker, error) {
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	t := &FileTracker{
+		path:           path,
+		ttl:            ttl,
+		ReservationTTL: DefaultReservationTTL,
+		entries:        make(map[string]fileEntry),
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	if err := t.compact(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *FileTracker) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+// load reads the records of the file, skipping lines that cannot be decoded.
+func (t *FileTracker) load() error {
+	f, err := os.Open(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.ID == "" {
+			continue // partly written line
+		}
+		if record.Expires == 0 {
+			delete(t.entries, record.ID)
+		} else {
+			t.entries[record.ID] = fileEntry{
+				expires:  time.Unix(0, record.Expires),
+				reserved: record.Reserved,
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *FileTracker) AddAndCheckIfDuplicate(_ context.Context, id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if _, ok := t.lookup(id, now); ok {
+		return true, nil
+	}
+	if err := t.set(id, fileEntry{expires: now.Add(t.ttl)}, now); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (t *FileTracker) Reserve(_ context.Context, id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if entry, ok := t.lookup(id, now); ok {
+		if entry.reserved {
+			return false, ErrIDReserved
+		}
+		return false, nil
+	}
+	if err := t.set(id, fileEntry{expires: now.Add(t.ReservationTTL), reserved: true}, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (t *FileTracker) Commit(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	return t.set(id, fileEntry{expires: now.Add(t.ttl)}, now)
+}
+
+func (t *FileTracker) Release(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry, ok := t.entries[id]; !ok || !entry.reserved {
+		return nil
+	}
+	if err := t.append(fileRecord{ID: id}); err != nil {
+		return err
+	}
+	delete(t.entries, id)
+	return nil
+}
+
+func (t *FileTracker) Remove(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.entries[id]; !ok {
+		return nil
+	}
+	if err := t.append(fileRecord{ID: id}); err != nil {
+		return err
+	}
+	delete(t.entries, id)
+	return nil
+}
+
+// lookup returns the entry of the ID if it has not expired.
+func (t *FileTracker) lookup(id string, now time.Time) (fileEntry, bool) {
+	entry, ok := t.entries[id]
+	if !ok || !now.Before(entry.expires) {
+		return fileEntry{}, false
+	}
+	return entry, true
+}
+
+// set records the entry of the ID, compacting the file if it has grown too
+// large. Expired IDs are only removed from entries by compaction, so the file
+// is also compacted once every ID it held when last compacted has expired.
+func (t *FileTracker) set(id string, entry fileEntry, now time.Time) error {
+	record := fileRecord{ID: id, Expires: entry.expires.UnixNano(), Reserved: entry.reserved}
+	if err := t.append(record); err != nil {
+		return err
+	}
+	t.entries[id] = entry
+
+	if t.records > fileTrackerCompactMin &&
+		(t.records > 2*len(t.entries) || !now.Before(t.compacted.Add(t.ttl))) {
+		// A failed compaction leaves the file as it was and is retried on
+		// a later add.
+		_ = t.compact()
+	}
+	return nil
+}
+
+// append writes a record to the end of the file.
+func (t *FileTracker) append(record fileRecord) error {
+	if t.closed {
+		return errFileTrackerClosed
+	} else if t.file == nil {
+		file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		t.file = file
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// A single write so that a crash leaves at most a partial last line
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	t.records++
+	return nil
+}
+
+// Compact rewrites the file with only the IDs which have not expired.
+func (t *FileTracker) Compact() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.compact()
+}
+
+func (t *FileTracker) compact() error {
+	if t.closed {
+		return errFileTrackerClosed
+	}
+
+	now := t.now()
+	for id, entry := range t.entries {
+		if !now.Before(entry.expires) {
+			delete(t.entries, id)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	w := bufio.NewWriter(tmp)
+	for id, entry := range t.entries {
+		record := fileRecord{ID: id, Expires: entry.expires.UnixNano(), Reserved: entry.reserved}
+		line, err := json.Marshal(record)
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		_, _ = w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(t.path))
+
+	file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		// The old file was replaced, so records must not be written to it
+		if t.file != nil {
+			_ = t.file.Close()
+			t.file = nil
+		}
+		return err
+	}
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+	t.file = file
+	t.records = len(t.entries)
+	t.compacted = now
+	return nil
+}
+
+// syncDir syncs a directory so that a rename within it is durable. Errors are
+// ignored since not every platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// Close syncs and closes the file.
+func (t *FileTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	if t.file == nil {
+		return nil
+	}
+
+	err := t.file.Sync()
+	if closeErr := t.file.Close(); err == nil {
+		err = closeErr
+	}
+	t.file = nil
+	return err
+}
@@ -0,0 +1,196 @@
+package eventsub_framework
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTracker_Restart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ids")
+
+	tracker, err := NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.NoError(t, tracker.Remove(ctx, "b"))
+	assert.NoError(t, tracker.Close())
+
+	tracker, err = NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	duplicate, err := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+	duplicate, err = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestFileTracker_Reserve(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ids")
+
+	tracker, err := NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := tracker.Reserve(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.ErrorIs(t, err, ErrIDReserved)
+
+	assert.NoError(t, tracker.Release(ctx, "a"))
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+	assert.NoError(t, tracker.Commit(ctx, "a"))
+	assert.NoError(t, tracker.Release(ctx, "a")) // committed IDs are not released
+
+	reserved, _ = tracker.Reserve(ctx, "b")
+	assert.True(t, reserved)
+	assert.NoError(t, tracker.Close())
+
+	// Committed IDs and reservations both survive a restart
+	tracker, err = NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.NoError(t, err)
+	reserved, err = tracker.Reserve(ctx, "b")
+	assert.False(t, reserved)
+	assert.ErrorIs(t, err, ErrIDReserved)
+}
+
+func TestFileTracker_PartialLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ids")
+
+	tracker, err := NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, tracker.Close())
+
+	// Simulate a crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"id":"b","expi`)
+	_ = f.Close()
+
+	tracker, err = NewFileTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.True(t, duplicate)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.False(t, duplicate)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "c")
+	assert.False(t, duplicate)
+
+	// The partial line was dropped, so new records are not corrupted
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, bytes.Count(data, []byte("\n")))
+	assert.NotContains(t, string(data), "expi\n")
+}
+
+func TestFileTracker_Compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ids")
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker, err := NewFileTracker(path, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	tracker.Clock = func() time.Time { return now }
+
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	now = now.Add(5 * time.Minute)
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	now = now.Add(5 * time.Minute)
+
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.True(t, duplicate)
+
+	assert.NoError(t, tracker.Compact())
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+	assert.Contains(t, string(data), `"id":"b"`)
+
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+}
+
+func TestFileTracker_AutoCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ids")
+	now := time.Now()
+
+	tracker, err := NewFileTracker(path, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	tracker.Clock = func() time.Time { return now }
+
+	for i := 0; i <= fileTrackerCompactMin; i++ {
+		_, _ = tracker.AddAndCheckIfDuplicate(ctx, strconv.Itoa(i))
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every ID has expired, but is still held until the file is compacted
+	now = now.Add(11 * time.Minute)
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Less(t, int64(len(data)), before.Size())
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+	assert.Contains(t, string(data), `"id":"a"`)
+}
+
+func TestFileTracker_Concurrent(t *testing.T) {
+	tracker, err := NewFileTracker(filepath.Join(t.TempDir(), "ids"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	testTrackerConcurrency(t, tracker)
+}
@@ -1,9 +1,11 @@
 module github.com/dnsge/twitch-eventsub-framework
 
-go 1.17
+go 1.18
 
 require (
 	github.com/dnsge/twitch-eventsub-bindings v1.2.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/mozillazg/go-httpheader v0.3.0
 	github.com/stretchr/testify v1.8.2
 )
@@ -1,9 +1,15 @@
 package eventsub_framework
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	esb "github.com/dnsge/twitch-eventsub-bindings"
 	"github.com/mozillazg/go-httpheader"
@@ -12,27 +18,139 @@ import (
 const (
 	webhookCallbackVerification = "webhook_callback_verification"
 	notificationMessageType     = "notification"
+	revocationMessageType       = "revocation"
 )
 
+const (
+	// DefaultMaxMessageAge is the maximum message age recommended by Twitch.
+	DefaultMaxMessageAge = 10 * time.Minute
+	// DefaultMaxClockSkew is how far in the future a message timestamp may be
+	// before it is rejected.
+	DefaultMaxClockSkew = time.Minute
+	// DefaultHandleTimeout is how long handlers may run before a notification
+	// is failed when AckAfterHandle is set. Twitch waits a few seconds for a
+	// response before treating a delivery as failed.
+	DefaultHandleTimeout = 2 * time.Second
+)
+
+// finishIDTimeout is how long committing or releasing a message ID may take.
+// It does not use the request context, which is often cancelled by the time
+// the message is handled.
+const finishIDTimeout = 5 * time.Second
+
+var (
+	errInvalidEvent            = errors.New("invalid event payload")
+	errUnknownNotificationType = errors.New("unknown notification type")
+)
+
+// UnsupportedVersionError is returned when a notification is received for a
+// known subscription type at a version that has no handler.
+type UnsupportedVersionError struct {
+	SubscriptionType string
+	Version          string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported version %q of subscription type %q", e.Version, e.SubscriptionType)
+}
+
+// revocationNotification is the body of a revocation message.
+type revocationNotification struct {
+	Subscription esb.Subscription `json:"subscription"`
+}
+
 // SubHandler implements http.Handler to receive Twitch webhook notifications.
 //
-// SubHandler handles both verification of new subscriptions and dispatching of
-// event notifications. To handle a specific event, set the corresponding
-// HandleXXX struct field. When a notification is received and validated, the
-// handler function will be invoked in a new goroutine.
+// SubHandler handles verification of new subscriptions, revocation of existing
+// subscriptions, and dispatching of event notifications. To handle a specific
+// event, set the corresponding HandleXXX struct field or register a handler
+// with On. When a notification is received and validated, the handler
+// function will be invoked in a new goroutine.
+//
+// Handlers registered with On receive a context which is cancelled if
+// Shutdown does not complete in time.
 type SubHandler struct {
 	doSignatureVerification bool
 	signatureSecret         []byte
 
+	// Maximum age of a message, as given by its timestamp header, before it is
+	// rejected to prevent replay attacks. A zero value disables the check.
+	MaxMessageAge time.Duration
+	// Maximum amount a message timestamp may be in the future before it is
+	// rejected. Only used if MaxMessageAge is non-zero.
+	MaxClockSkew time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
 	// Challenge handler function.
 	// Returns whether the subscription should be accepted.
 	VerifyChallenge func(h *esb.ResponseHeaders, chal *esb.SubscriptionChallenge) bool
 
-	// IDTracker used to deduplicate notifications
+	// IDTracker used to deduplicate notifications. If it implements
+	// ReservingIDTracker, message IDs are reserved while a message is handled
+	// and only committed once it is acknowledged. A redelivery of a message
+	// which is still being handled is rejected with a 5xx status so that
+	// Twitch delivers it again, in case handling fails.
 	IDTracker               IDTracker
 	OnDuplicateNotification func(h *esb.ResponseHeaders)
-
-	HandleChannelUpdate func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate)
+	// Called when IDTracker fails to commit or release a message ID. If nil,
+	// the error is logged.
+	OnIDTrackerError func(h *esb.ResponseHeaders, err error)
+
+	// Registry of handlers registered with On, in addition to the HandleXXX
+	// fields.
+	Registry *Registry
+	// Called when a handler registered with On returns an error.
+	OnHandlerError func(h *esb.ResponseHeaders, err error)
+	// Called with the recovered value and stack trace when a handler panics.
+	// If nil, the panic is logged.
+	OnHandlerPanic func(h *esb.ResponseHeaders, recovered interface{}, stack []byte)
+
+	// Whether to wait for handlers before responding to a notification. If a
+	// handler returns an error, panics, or does not return within
+	// HandleTimeout, a 5xx status is returned so that Twitch redelivers the
+	// notification, and the message ID is released from IDTracker.
+	// Otherwise, notifications are acknowledged as soon as handlers are
+	// started.
+	AckAfterHandle bool
+	// How long to wait for handlers when AckAfterHandle is set. A zero value
+	// waits indefinitely. Handlers which time out have their context
+	// cancelled, and the message ID stays reserved until they return, so a
+	// redelivery in the meantime is rejected rather than handled at the same
+	// time.
+	HandleTimeout time.Duration
+
+	// Dispatcher used to run handlers. If nil, each handler is run in a new
+	// goroutine. See NewWorkerPool to bound the number of running handlers and
+	// NewOrderedDispatcher to handle notifications in order. OnRevocation,
+	// OnDuplicateNotification and OnUnknownNotification are always run in a
+	// new goroutine.
+	Dispatcher Dispatcher
+
+	// Called with the raw subscription and event when a notification has no
+	// handler, either because its subscription type or version is unknown or
+	// because no handler is set for it. Notifications of unknown subscription
+	// types and versions are only passed to it if AckUnknownNotifications is
+	// set, so that it is called once per message rather than once per
+	// redelivery.
+	OnUnknownNotification func(h *esb.ResponseHeaders, rawSubscription, rawEvent json.RawMessage)
+	// Whether to respond with a 2xx status to notifications of unknown
+	// subscription types and versions. Otherwise, they are rejected with a
+	// 4xx status, which Twitch counts as a failed delivery. Too many failed
+	// deliveries cause Twitch to revoke the subscription.
+	AckUnknownNotifications bool
+
+	// Revocation handler function.
+	// Called when Twitch revokes a subscription, with the reason given by the
+	// subscription's status.
+	OnRevocation func(h *esb.ResponseHeaders, sub *esb.Subscription, reason Status)
+
+	stateOnce sync.Once
+	state     *dispatchState
+
+	HandleChannelUpdate   func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate)
+	HandleChannelUpdateV2 func(h *esb.ResponseHeaders, event *EventChannelUpdateV2)
+	// Invoked for versions 1 and 2, which share the same event payload.
 	HandleChannelFollow func(h *esb.ResponseHeaders, event *esb.EventChannelFollow)
 	HandleUserUpdate    func(h *esb.ResponseHeaders, event *esb.EventUserUpdate)
 
@@ -139,6 +257,8 @@ type SubHandler struct {
 		h *esb.ResponseHeaders,
 		event *esb.EventChannelChatNotification,
 	)
+
+	HandleConduitShardDisabled func(h *esb.ResponseHeaders, event *EventConduitShardDisabled)
 }
 
 func NewSubHandler(doSignatureVerification bool, secret []byte) *SubHandler {
@@ -149,6 +269,10 @@ func NewSubHandler(doSignatureVerification bool, secret []byte) *SubHandler {
 	return &SubHandler{
 		doSignatureVerification: doSignatureVerification,
 		signatureSecret:         secret,
+		MaxMessageAge:           DefaultMaxMessageAge,
+		MaxClockSkew:            DefaultMaxClockSkew,
+		HandleTimeout:           DefaultHandleTimeout,
+		Registry:                NewRegistry(),
 	}
 }
 
@@ -161,6 +285,11 @@ func (s *SubHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *SubHandler) handlePost(w http.ResponseWriter, r *http.Request) {
+	if s.isShutdown() {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Read body into buffer
 	defer r.Body.Close()
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -183,8 +312,17 @@ func (s *SubHandler) handlePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.checkTimestamp(&h); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	isDuplicate, err := s.checkIfDuplicate(w, r, &h)
-	if err != nil {
+	if errors.Is(err, ErrIDReserved) {
+		// Only acknowledge the message once it has been handled
+		http.Error(w, "Message is being handled", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
 		// Error occurred while checking IDTracker
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -192,17 +330,59 @@ func (s *SubHandler) handlePost(w http.ResponseWriter, r *http.Request) {
 		return // already handled response
 	}
 
+	// Commit the message ID if the message is acknowledged, or else release
+	// it so that the redelivery is not treated as a duplicate
+	rec := &statusRecorder{ResponseWriter: w}
+	var timedOut *dispatchResult
+	defer func() {
+		if timedOut != nil {
+			// Keep the message ID reserved until the handlers return, so
+			// that a redelivery is not handled at the same time
+			go func() {
+				timedOut.waitReturned()
+				s.finishID(&h, false)
+			}()
+			return
+		}
+		s.finishID(&h, rec.status >= 200 && rec.status < 300)
+	}()
+
 	switch h.MessageType {
 	case webhookCallbackVerification:
-		s.handleVerification(w, bodyBytes, &h)
-		return
+		s.handleVerification(rec, bodyBytes, &h)
 	case notificationMessageType:
-		s.handleNotification(w, bodyBytes, &h)
-		return
+		timedOut = s.handleNotification(rec, r, bodyBytes, &h)
+	case revocationMessageType:
+		s.handleRevocation(rec, bodyBytes, &h)
 	default:
-		http.Error(w, "Unknown message type", http.StatusBadRequest)
-		return
+		http.Error(rec, "Unknown message type", http.StatusBadRequest)
+	}
+}
+
+// checkTimestamp returns an error if the message timestamp is older than
+// MaxMessageAge or further in the future than MaxClockSkew.
+func (s *SubHandler) checkTimestamp(h *esb.ResponseHeaders) error {
+	if s.MaxMessageAge <= 0 {
+		return nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, h.MessageTimestamp)
+	if err != nil {
+		return errors.New("invalid message timestamp")
+	}
+
+	now := time.Now
+	if s.Clock != nil {
+		now = s.Clock
+	}
+
+	age := now().Sub(timestamp)
+	if age > s.MaxMessageAge {
+		return errors.New("message timestamp too old")
+	} else if -age > s.MaxClockSkew {
+		return errors.New("message timestamp in the future")
 	}
+	return nil
 }
 
 // checkIfDuplicate returns whether the IDTracker reports this notification is
@@ -213,24 +393,42 @@ func (s *SubHandler) checkIfDuplicate(
 	r *http.Request,
 	h *esb.ResponseHeaders,
 ) (bool, error) {
-	if s.IDTracker != nil {
-		duplicate, err := s.IDTracker.AddAndCheckIfDuplicate(r.Context(), h.MessageID)
-		if err != nil {
-			return false, err
-		}
+	duplicate, err := s.isDuplicate(r.Context(), h)
+	if err != nil {
+		return false, err
+	}
 
-		if duplicate {
-			if s.OnDuplicateNotification != nil {
-				go s.OnDuplicateNotification(h)
-			}
-			writeEmptyOK(w) // ignore and return 2XX code
-			return true, nil
-		}
+	if duplicate {
+		writeEmptyOK(w) // ignore and return 2XX code
+		return true, nil
 	}
 
 	return false, nil
 }
 
+// isDuplicate reserves the message ID with the IDTracker, returning whether
+// it is a duplicate and invoking OnDuplicateNotification if it is. If the
+// message is still being handled, it returns ErrIDReserved. If it is not a
+// duplicate, finishID must be called once the message is handled.
+func (s *SubHandler) isDuplicate(ctx context.Context, h *esb.ResponseHeaders) (bool, error) {
+	if s.IDTracker == nil {
+		return false, nil
+	}
+
+	reserved, err := AdaptIDTracker(s.IDTracker).Reserve(ctx, h.MessageID)
+	if err != nil {
+		return false, err
+	}
+	duplicate := !reserved
+
+	if duplicate && s.OnDuplicateNotification != nil {
+		_ = s.goCallback(h, func(_ context.Context) {
+			s.OnDuplicateNotification(h)
+		})
+	}
+	return duplicate, nil
+}
+
 func (s *SubHandler) handleVerification(
 	w http.ResponseWriter,
 	bodyBytes []byte,
@@ -251,423 +449,196 @@ func (s *SubHandler) handleVerification(
 	}
 }
 
-func (s *SubHandler) handleNotification(
+func (s *SubHandler) handleRevocation(
 	w http.ResponseWriter,
 	bodyBytes []byte,
 	h *esb.ResponseHeaders,
 ) {
-	var notification esb.EventNotification
-	if err := json.Unmarshal(bodyBytes, &notification); err != nil {
+	var data revocationNotification
+	if err := json.Unmarshal(bodyBytes, &data); err != nil {
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
-	event := notification.Event
 
-	switch h.SubscriptionType {
-	case "channel.update":
-		var data esb.EventChannelUpdate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelUpdate != nil {
-			go s.HandleChannelUpdate(h, &data)
-		}
-	case "channel.follow":
-		var data esb.EventChannelFollow
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelFollow != nil {
-			go s.HandleChannelFollow(h, &data)
-		}
-	case "channel.subscribe":
-		var data esb.EventChannelSubscribe
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelSubscribe != nil {
-			go s.HandleChannelSubscribe(h, &data)
-		}
-	case "channel.subscription.end":
-		var data esb.EventChannelSubscriptionEnd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelSubscriptionEnd != nil {
-			go s.HandleChannelSubscriptionEnd(h, &data)
-		}
-	case "channel.subscription.gift":
-		var data esb.EventChannelSubscriptionGift
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelSubscriptionGift != nil {
-			go s.HandleChannelSubscriptionGift(h, &data)
-		}
-	case "channel.subscription.message":
-		var data esb.EventChannelSubscriptionMessage
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelSubscriptionMessage != nil {
-			go s.HandleChannelSubscriptionMessage(h, &data)
-		}
-	case "channel.cheer":
-		var data esb.EventChannelCheer
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelCheer != nil {
-			go s.HandleChannelCheer(h, &data)
-		}
-	case "channel.raid":
-		var data esb.EventChannelRaid
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelRaid != nil {
-			go s.HandleChannelRaid(h, &data)
-		}
-	case "channel.ban":
-		var data esb.EventChannelBan
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelBan != nil {
-			go s.HandleChannelBan(h, &data)
-		}
-	case "channel.unban":
-		var data esb.EventChannelUnban
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelUnban != nil {
-			go s.HandleChannelUnban(h, &data)
-		}
-	case "channel.unban_request.create":
-		var data esb.ChannelUnbanRequestCreate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelUnbanRequestCreate != nil {
-			go s.HandleChannelUnbanRequestCreate(h, &data)
-		}
-	case "channel.unban_request.resolve":
-		var data esb.ChannelUnbanRequestResolve
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelUnbanRequestResolve != nil {
-			go s.HandleChannelUnbanRequestResolve(h, &data)
-		}
-	case "channel.moderator.add":
-		var data esb.EventChannelModeratorAdd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelModeratorAdd != nil {
-			go s.HandleChannelModeratorAdd(h, &data)
-		}
-	case "channel.moderator.remove":
-		var data esb.EventChannelModeratorRemove
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelModeratorRemove != nil {
-			go s.HandleChannelModeratorRemove(h, &data)
-		}
-	case "channel.channel_points_custom_reward.add":
-		var data esb.EventChannelPointsRewardAdd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPointsRewardAdd != nil {
-			go s.HandleChannelPointsRewardAdd(h, &data)
-		}
-	case "channel.channel_points_custom_reward.update":
-		var data esb.EventChannelPointsRewardUpdate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPointsRewardUpdate != nil {
-			go s.HandleChannelPointsRewardUpdate(h, &data)
-		}
-	case "channel.channel_points_custom_reward.remove":
-		var data esb.EventChannelPointsRewardRemove
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPointsRewardRemove != nil {
-			go s.HandleChannelPointsRewardRemove(h, &data)
-		}
-	case "channel.channel_points_custom_reward_redemption.add":
-		var data esb.EventChannelPointsRewardRedemptionAdd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPointsRewardRedemptionAdd != nil {
-			go s.HandleChannelPointsRewardRedemptionAdd(h, &data)
-		}
-	case "channel.channel_points_custom_reward_redemption.update":
-		var data esb.EventChannelPointsRewardRedemptionUpdate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPointsRewardRedemptionUpdate != nil {
-			go s.HandleChannelPointsRewardRedemptionUpdate(h, &data)
-		}
-	case "channel.poll.begin":
-		var data esb.EventChannelPollBegin
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPollBegin != nil {
-			go s.HandleChannelPollBegin(h, &data)
-		}
-	case "channel.poll.progress":
-		var data esb.EventChannelPollProgress
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPollProgress != nil {
-			go s.HandleChannelPollProgress(h, &data)
-		}
-	case "channel.poll.end":
-		var data esb.EventChannelPollEnd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPollEnd != nil {
-			go s.HandleChannelPollEnd(h, &data)
-		}
-	case "channel.prediction.begin":
-		var data esb.EventChannelPredictionBegin
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPredictionBegin != nil {
-			go s.HandleChannelPredictionBegin(h, &data)
-		}
-	case "channel.prediction.progress":
-		var data esb.EventChannelPredictionProgress
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPredictionProgress != nil {
-			go s.HandleChannelPredictionProgress(h, &data)
-		}
-	case "channel.prediction.lock":
-		var data esb.EventChannelPredictionLock
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPredictionLock != nil {
-			go s.HandleChannelPredictionLock(h, &data)
-		}
-	case "channel.prediction.end":
-		var data esb.EventChannelPredictionEnd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelPredictionEnd != nil {
-			go s.HandleChannelPredictionEnd(h, &data)
-		}
-	case "drop.entitlement.grant":
-		var data esb.EventDropEntitlementGrant
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleDropEntitlementGrant != nil {
-			go s.HandleDropEntitlementGrant(h, &data)
-		}
-	case "extension.bits_transaction.create":
-		var data esb.EventBitsTransactionCreate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleExtensionBitsTransactionCreate != nil {
-			go s.HandleExtensionBitsTransactionCreate(h, &data)
-		}
-	case "channel.goal.begin":
-		var data esb.EventGoals
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleGoalBegin != nil {
-			go s.HandleGoalBegin(h, &data)
-		}
-	case "channel.goal.progress":
-		var data esb.EventGoals
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleGoalProgress != nil {
-			go s.HandleGoalProgress(h, &data)
-		}
-	case "channel.goal.end":
-		var data esb.EventGoals
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleGoalEnd != nil {
-			go s.HandleGoalEnd(h, &data)
-		}
-	case "channel.hype_train.begin":
-		var data esb.EventHypeTrainBegin
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleHypeTrainBegin != nil {
-			go s.HandleHypeTrainBegin(h, &data)
-		}
-	case "channel.hype_train.progress":
-		var data esb.EventHypeTrainProgress
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleHypeTrainProgress != nil {
-			go s.HandleHypeTrainProgress(h, &data)
-		}
-	case "channel.hype_train.end":
-		var data esb.EventHypeTrainEnd
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleHypeTrainEnd != nil {
-			go s.HandleHypeTrainEnd(h, &data)
-		}
-	case "stream.online":
-		var data esb.EventStreamOnline
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleStreamOnline != nil {
-			go s.HandleStreamOnline(h, &data)
-		}
-	case "stream.offline":
-		var data esb.EventStreamOffline
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleStreamOffline != nil {
-			go s.HandleStreamOffline(h, &data)
-		}
-	case "user.authorization.grant":
-		var data esb.EventUserAuthorizationGrant
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleUserAuthorizationGrant != nil {
-			go s.HandleUserAuthorizationGrant(h, &data)
-		}
-	case "user.authorization.revoke":
-		var data esb.EventUserAuthorizationRevoke
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleUserAuthorizationRevoke != nil {
-			go s.HandleUserAuthorizationRevoke(h, &data)
-		}
-	case "user.update":
-		var data esb.EventUserUpdate
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleUserUpdate != nil {
-			go s.HandleUserUpdate(h, &data)
-		}
-	case "channel.chat.message":
-		var data esb.EventChannelChatMessage
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelChatMessage != nil {
-			go s.HandleChannelChatMessage(h, &data)
-		}
-	case "channel.chat.clear":
-		var data esb.EventChannelChatClear
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelChatClear != nil {
-			go s.HandleChannelChatClear(h, &data)
-		}
-	case "channel.chat.clear_user_messages":
-		var data esb.EventChannelChatClearUserMessages
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelChatClearUserMessages != nil {
-			go s.HandleChannelChatClearUserMessages(h, &data)
-		}
-	case "channel.chat.message_delete":
-		var data esb.EventChannelChatMessageDelete
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelChatMessageDelete != nil {
-			go s.HandleChannelChatMessageDelete(h, &data)
-		}
-	case "channel.chat.notification":
-		var data esb.EventChannelChatNotification
-		if err := json.Unmarshal(event, &data); err != nil {
-			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if s.HandleChannelChatNotification != nil {
-			go s.HandleChannelChatNotification(h, &data)
-		}
-	default:
-		http.Error(w, "Unknown notification type", http.StatusBadRequest)
+	if err := s.dispatchRevocation(h, &data.Subscription); err != nil {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 		return
 	}
+	writeEmptyOK(w)
+}
+
+// dispatchRevocation invokes OnRevocation in a new goroutine. ErrShutdown is
+// returned if the SubHandler has been shut down.
+func (s *SubHandler) dispatchRevocation(h *esb.ResponseHeaders, sub *esb.Subscription) error {
+	if s.OnRevocation == nil {
+		return nil
+	}
+	return s.goCallback(h, func(_ context.Context) {
+		s.OnRevocation(h, sub, Status(sub.Status))
+	})
+}
+
+// handleNotification dispatches a notification and responds to it. If
+// AckAfterHandle is set and the handlers time out, the handlers are still
+// running and their dispatchResult is returned.
+func (s *SubHandler) handleNotification(
+	w http.ResponseWriter,
+	r *http.Request,
+	bodyBytes []byte,
+	h *esb.ResponseHeaders,
+) *dispatchResult {
+	d, err := decodeDelivery(r.Context(), h, bodyBytes)
+	if err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return nil
+	}
+
+	var timeout time.Duration
+	if s.AckAfterHandle {
+		timeout = s.HandleTimeout
+	}
+
+	result, err := s.dispatchEvent(d, timeout)
+	if err != nil {
+		var versionErr *UnsupportedVersionError
+		var dispatchErr *dispatchError
+		if errors.Is(err, ErrShutdown) || errors.As(err, &dispatchErr) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		} else if errors.Is(err, errUnknownNotificationType) {
+			http.Error(w, "Unknown notification type", http.StatusBadRequest)
+		} else if errors.As(err, &versionErr) {
+			http.Error(w, versionErr.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		}
+		return nil
+	}
+
+	if s.AckAfterHandle {
+		if err := result.wait(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				http.Error(w, "Handler timed out", http.StatusServiceUnavailable)
+				return result
+			}
+			http.Error(w, "Handler failed", http.StatusInternalServerError)
+			return nil
+		}
+	}
 
 	writeEmptyOK(w)
+	return nil
 }
 
+// finishID commits the message ID reserved by isDuplicate if the message was
+// handled, or else releases it so that a redelivery of the message is not
+// treated as a duplicate. Errors are reported to OnIDTrackerError.
+func (s *SubHandler) finishID(h *esb.ResponseHeaders, handled bool) {
+	if s.IDTracker == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), finishIDTimeout)
+	defer cancel()
+
+	tracker := AdaptIDTracker(s.IDTracker)
+	var err error
+	if handled {
+		err = tracker.Commit(ctx, h.MessageID)
+	} else {
+		err = tracker.Release(ctx, h.MessageID)
+	}
+	if err == nil {
+		return
+	}
+
+	if s.OnIDTrackerError != nil {
+		s.OnIDTrackerError(h, err)
+	} else {
+		log.Printf("eventsub_framework: finish message %s: %v", h.MessageID, err)
+	}
+}
+
+// statusRecorder records the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// fieldHandlers maps each subscription type and version to the decoder for
+// its HandleXXX field.
+var fieldHandlers = map[registryKey]func(s *SubHandler) eventDecoder{
+	{"channel.update", "1"}:                                         func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelUpdate) },
+	{"channel.update", "2"}:                                         func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelUpdateV2) },
+	{"channel.follow", "1"}:                                         func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelFollow) },
+	{"channel.follow", "2"}:                                         func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelFollow) },
+	{"channel.subscribe", "1"}:                                      func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelSubscribe) },
+	{"channel.subscription.end", "1"}:                               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelSubscriptionEnd) },
+	{"channel.subscription.gift", "1"}:                              func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelSubscriptionGift) },
+	{"channel.subscription.message", "1"}:                           func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelSubscriptionMessage) },
+	{"channel.cheer", "1"}:                                          func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelCheer) },
+	{"channel.raid", "1"}:                                           func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelRaid) },
+	{"channel.ban", "1"}:                                            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelBan) },
+	{"channel.unban", "1"}:                                          func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelUnban) },
+	{"channel.unban_request.create", "1"}:                           func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelUnbanRequestCreate) },
+	{"channel.unban_request.resolve", "1"}:                          func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelUnbanRequestResolve) },
+	{"channel.moderator.add", "1"}:                                  func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelModeratorAdd) },
+	{"channel.moderator.remove", "1"}:                               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelModeratorRemove) },
+	{"channel.channel_points_custom_reward.add", "1"}:               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPointsRewardAdd) },
+	{"channel.channel_points_custom_reward.update", "1"}:            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPointsRewardUpdate) },
+	{"channel.channel_points_custom_reward.remove", "1"}:            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPointsRewardRemove) },
+	{"channel.channel_points_custom_reward_redemption.add", "1"}:    func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPointsRewardRedemptionAdd) },
+	{"channel.channel_points_custom_reward_redemption.update", "1"}: func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPointsRewardRedemptionUpdate) },
+	{"channel.poll.begin", "1"}:                                     func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPollBegin) },
+	{"channel.poll.progress", "1"}:                                  func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPollProgress) },
+	{"channel.poll.end", "1"}:                                       func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPollEnd) },
+	{"channel.prediction.begin", "1"}:                               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPredictionBegin) },
+	{"channel.prediction.progress", "1"}:                            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPredictionProgress) },
+	{"channel.prediction.lock", "1"}:                                func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPredictionLock) },
+	{"channel.prediction.end", "1"}:                                 func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelPredictionEnd) },
+	{"drop.entitlement.grant", "1"}:                                 func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleDropEntitlementGrant) },
+	{"extension.bits_transaction.create", "1"}:                      func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleExtensionBitsTransactionCreate) },
+	{"channel.goal.begin", "1"}:                                     func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleGoalBegin) },
+	{"channel.goal.progress", "1"}:                                  func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleGoalProgress) },
+	{"channel.goal.end", "1"}:                                       func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleGoalEnd) },
+	{"channel.hype_train.begin", "1"}:                               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleHypeTrainBegin) },
+	{"channel.hype_train.progress", "1"}:                            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleHypeTrainProgress) },
+	{"channel.hype_train.end", "1"}:                                 func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleHypeTrainEnd) },
+	{"stream.online", "1"}:                                          func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleStreamOnline) },
+	{"stream.offline", "1"}:                                         func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleStreamOffline) },
+	{"user.authorization.grant", "1"}:                               func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleUserAuthorizationGrant) },
+	{"user.authorization.revoke", "1"}:                              func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleUserAuthorizationRevoke) },
+	{"user.update", "1"}:                                            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleUserUpdate) },
+	{"channel.chat.message", "1"}:                                   func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelChatMessage) },
+	{"channel.chat.clear", "1"}:                                     func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelChatClear) },
+	{"channel.chat.clear_user_messages", "1"}:                       func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelChatClearUserMessages) },
+	{"channel.chat.message_delete", "1"}:                            func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelChatMessageDelete) },
+	{"channel.chat.notification", "1"}:                              func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleChannelChatNotification) },
+	{"conduit.shard.disabled", "1"}:                                 func(s *SubHandler) eventDecoder { return fieldDecoder(s.HandleConduitShardDisabled) },
+}
+
+// fieldTypes contains each subscription type in fieldHandlers.
+var fieldTypes = func() map[string]bool {
+	types := make(map[string]bool)
+	for key := range fieldHandlers {
+		types[key.subscriptionType] = true
+	}
+	return types
+}()
+
 // Writes a 200 OK response
 func writeEmptyOK(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusOK)
@@ -3,6 +3,7 @@ package eventsub_framework
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	esb "github.com/dnsge/twitch-eventsub-bindings"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -12,10 +13,14 @@ import (
 	"time"
 )
 
-const secret = `hey this is really secret`
+const (
+	secret   = `hey this is really secret`
+	testTime = "2023-03-09T04:46:00Z"
+)
 
 func TestSubHandler_ServeHTTP_VerificationBasic(t *testing.T) {
 	handler := NewSubHandler(true, []byte(secret))
+	handler.Clock = clockAt(testTime)
 	res := handleRequest(handler, newVerificationRequest)
 	body, _ := io.ReadAll(res.Body)
 	_ = res.Body.Close()
@@ -26,6 +31,7 @@ func TestSubHandler_ServeHTTP_VerificationBasic(t *testing.T) {
 
 func TestSubHandler_ServeHTTP_VerificationInvalidSignature(t *testing.T) {
 	handler := NewSubHandler(true, []byte(secret))
+	handler.Clock = clockAt(testTime)
 
 	// Test invalid signature
 	res := handleRequest(handler, newBadVerificationRequest)
@@ -40,6 +46,7 @@ func TestSubHandler_ServeHTTP_VerificationInvalidSignature(t *testing.T) {
 
 func TestSubHandler_ServeHTTP_VerificationDynamic(t *testing.T) {
 	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
 	handler.VerifyChallenge = func(h *esb.ResponseHeaders, chal *esb.SubscriptionChallenge) bool {
 		return h.SubscriptionType == "channel.update"
 	}
@@ -60,6 +67,7 @@ func TestSubHandler_ServeHTTP_VerificationDynamic(t *testing.T) {
 
 func TestSubHandler_ServeHTTP_IDTracker(t *testing.T) {
 	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
 	tracker := &wrapper{m: NewMapTracker(), DuplicateSeen: false}
 	handler.IDTracker = tracker
 
@@ -81,6 +89,7 @@ func TestSubHandler_ServeHTTP_IDTracker(t *testing.T) {
 func TestSubHandler_ServeHTTP_Notification(t *testing.T) {
 	d := newDispatcher(1)
 	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
 	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
 		d.Trigger()
 	}
@@ -91,6 +100,168 @@ func TestSubHandler_ServeHTTP_Notification(t *testing.T) {
 	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "HandleChannelUpdate failed to trigger")
 }
 
+func TestSubHandler_ServeHTTP_NotificationVersion(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		t.Error("HandleChannelUpdate invoked for version 2")
+	}
+	handler.HandleChannelUpdateV2 = func(h *esb.ResponseHeaders, event *EventChannelUpdateV2) {
+		assert.Equal(t, []string{"Gambling"}, event.ContentClassificationLabels)
+		d.Trigger()
+	}
+
+	res := handleRequest(handler, newNotificationRequestV2)
+
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "HandleChannelUpdateV2 failed to trigger")
+}
+
+func TestSubHandler_ServeHTTP_NotificationUnsupportedVersion(t *testing.T) {
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+
+	res := handleRequest(handler, func() *http.Request {
+		req := newNotificationRequest()
+		req.Header.Set("Twitch-Eventsub-Subscription-Version", "3")
+		return req
+	})
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Contains(t, string(body), `unsupported version "3" of subscription type "channel.update"`)
+}
+
+func TestSubHandler_ServeHTTP_UnknownNotification(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.OnUnknownNotification = func(h *esb.ResponseHeaders, rawSubscription, rawEvent json.RawMessage) {
+		assert.Contains(t, string(rawSubscription), `"id":"ef7e8fba-6c32-4ead-965d-61f21660d095"`)
+		assert.Contains(t, string(rawEvent), `"title":"hello there!"`)
+		d.Trigger()
+	}
+	newBetaRequest := func() *http.Request {
+		req := newNotificationRequest()
+		req.Header.Set("Twitch-Eventsub-Subscription-Type", "channel.beta")
+		return req
+	}
+
+	// Unknown types are rejected by default, without invoking the fallback
+	// for each redelivery
+	handler.IDTracker = NewMapTracker()
+	for i := 0; i < 2; i++ {
+		res := handleRequest(handler, newBetaRequest)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+	assert.False(t, d.WaitForTrigger(100*time.Millisecond), "OnUnknownNotification triggered for a rejected notification")
+
+	handler.AckUnknownNotifications = true
+	res := handleRequest(handler, newBetaRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "OnUnknownNotification failed to trigger")
+
+	// Acknowledged, so the redelivery is a duplicate
+	res = handleRequest(handler, newBetaRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.False(t, d.WaitForTrigger(100*time.Millisecond), "OnUnknownNotification triggered for a duplicate")
+
+	// Known types without a handler are acknowledged
+	handler.IDTracker = nil
+	handler.AckUnknownNotifications = false
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "OnUnknownNotification failed to trigger")
+}
+
+func TestSubHandler_ServeHTTP_Revocation(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason Status) {
+		assert.Equal(t, "f1c2a387-161a-49f9-a165-0f21d7a4e1c4", sub.ID)
+		assert.Equal(t, StatusAuthorizationRevoked, reason)
+		d.Trigger()
+	}
+
+	res := handleRequest(handler, newRevocationRequest)
+
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "OnRevocation failed to trigger")
+}
+
+func TestSubHandler_ServeHTTP_DuplicateRevocation(t *testing.T) {
+	d := newDispatcher(2)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.IDTracker = NewMapTracker()
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason Status) {
+		d.Trigger()
+	}
+
+	res := handleRequest(handler, newRevocationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "OnRevocation failed to trigger")
+
+	res = handleRequest(handler, newRevocationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.False(t, d.WaitForTrigger(50*time.Millisecond), "OnRevocation was called for a duplicate")
+}
+
+func TestSubHandler_ServeHTTP_MessageAge(t *testing.T) {
+	handler := NewSubHandler(true, []byte(secret))
+
+	// Message is five minutes old
+	handler.Clock = clockAt("2023-03-09T04:49:48Z")
+	res := handleRequest(handler, newVerificationRequest)
+	_ = res.Body.Close()
+	assert.True(t, isOK(res.StatusCode))
+
+	// Message is more than ten minutes old
+	handler.Clock = clockAt("2023-03-09T04:55:00Z")
+	res = handleRequest(handler, newVerificationRequest)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Message is more than a minute in the future
+	handler.Clock = clockAt("2023-03-09T04:42:00Z")
+	res = handleRequest(handler, newVerificationRequest)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Message is slightly in the future
+	handler.Clock = clockAt("2023-03-09T04:44:30Z")
+	res = handleRequest(handler, newVerificationRequest)
+	_ = res.Body.Close()
+	assert.True(t, isOK(res.StatusCode))
+
+	// Check is disabled
+	handler.MaxMessageAge = 0
+	handler.Clock = clockAt("2024-03-09T04:44:48Z")
+	res = handleRequest(handler, newVerificationRequest)
+	_ = res.Body.Close()
+	assert.True(t, isOK(res.StatusCode))
+}
+
+func TestSubHandler_ServeHTTP_ConduitShardDisabled(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.HandleConduitShardDisabled = func(h *esb.ResponseHeaders, event *EventConduitShardDisabled) {
+		assert.Equal(t, "4", event.ShardID)
+		assert.Equal(t, StatusWebSocketDisconnected, event.Status)
+		assert.Equal(t, "ad1c9fc3-0d99-4eb7-8a04-8608e8ff9ec9", event.Transport.SessionID)
+		d.Trigger()
+	}
+
+	res := handleRequest(handler, newConduitShardDisabledRequest)
+
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "HandleConduitShardDisabled failed to trigger")
+}
+
 func handleRequest(handler *SubHandler, reqFactory func() *http.Request) *http.Response {
 	verificationReq := reqFactory()
 	w := httptest.NewRecorder()
@@ -158,6 +329,67 @@ func newNotificationRequest() *http.Request {
 	return req
 }
 
+func newNotificationRequestV2() *http.Request {
+	bodyData := []byte(`{"subscription":{"id":"ef7e8fba-6c32-4ead-965d-61f21660d095","status":"enabled","type":"channel.update","version":"2","condition":{"broadcaster_user_id":"132532813"},"transport":{"method":"webhook","callback":"https://testing.proxy.b.dnsge.org/webhooks"},"created_at":"2023-03-09T04:44:48.057734342Z","cost":0},"event":{"broadcaster_user_id":"132532813","broadcaster_user_login":"icelys","broadcaster_user_name":"icelys","title":"hello there!","language":"en","category_id":"509658","category_name":"Just Chatting","content_classification_labels":["Gambling"]}}`)
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(bodyData))
+	req.Header = http.Header{
+		"Content-Type":                         {"application/json"},
+		"Twitch-Eventsub-Message-Id":           {"c5b3d2a1-51c5-4b09-9c07-9b2f4e2f0a41"},
+		"Twitch-Eventsub-Message-Retry":        {"0"},
+		"Twitch-Eventsub-Message-Timestamp":    {"2023-03-09T04:45:36.836089549Z"},
+		"Twitch-Eventsub-Message-Type":         {"notification"},
+		"Twitch-Eventsub-Subscription-Type":    {"channel.update"},
+		"Twitch-Eventsub-Subscription-Version": {"2"},
+	}
+
+	return req
+}
+
+func newRevocationRequest() *http.Request {
+	bodyData := []byte(`{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"authorization_revoked","type":"channel.follow","cost":1,"version":"1","condition":{"broadcaster_user_id":"12826"},"transport":{"method":"webhook","callback":"https://example.com/webhooks/callback"},"created_at":"2019-11-16T10:11:12.634234626Z"}}`)
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(bodyData))
+	req.Header = http.Header{
+		"Content-Type":                         {"application/json"},
+		"Twitch-Eventsub-Message-Id":           {"84c1e79a-2a4b-4c13-ba0b-4312293e9308"},
+		"Twitch-Eventsub-Message-Retry":        {"0"},
+		"Twitch-Eventsub-Message-Timestamp":    {"2023-03-09T04:45:40.634234626Z"},
+		"Twitch-Eventsub-Message-Type":         {"revocation"},
+		"Twitch-Eventsub-Subscription-Type":    {"channel.follow"},
+		"Twitch-Eventsub-Subscription-Version": {"1"},
+	}
+
+	return req
+}
+
+func newConduitShardDisabledRequest() *http.Request {
+	bodyData := []byte(`{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"conduit.shard.disabled","version":"1","status":"enabled","cost":0,"condition":{"client_id":"uo6dggojyb8d6soh92zknwmi5ej1q2"},"transport":{"method":"webhook","callback":"https://example.com/webhooks/callback"},"created_at":"2023-04-11T10:11:12.123Z"},"event":{"conduit_id":"bfcfc993-26b1-b876-44d9-afe75a379dac","shard_id":"4","status":"websocket_disconnected","transport":{"method":"websocket","session_id":"ad1c9fc3-0d99-4eb7-8a04-8608e8ff9ec9","connected_at":"2020-11-10T14:32:18.730260295Z","disconnected_at":"2020-11-11T14:32:18.730260295Z"}}}`)
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(bodyData))
+	req.Header = http.Header{
+		"Content-Type":                         {"application/json"},
+		"Twitch-Eventsub-Message-Id":           {"befa7b53-d79d-478f-86b9-120f112b044e"},
+		"Twitch-Eventsub-Message-Retry":        {"0"},
+		"Twitch-Eventsub-Message-Timestamp":    {"2023-03-09T04:45:40.634234626Z"},
+		"Twitch-Eventsub-Message-Type":         {"notification"},
+		"Twitch-Eventsub-Subscription-Type":    {"conduit.shard.disabled"},
+		"Twitch-Eventsub-Subscription-Version": {"1"},
+	}
+
+	return req
+}
+
+func clockAt(timestamp string) func() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		panic(err)
+	}
+	return func() time.Time {
+		return t
+	}
+}
+
 func isOK(statusCode int) bool {
 	return 200 <= statusCode && statusCode < 300
 }
@@ -1,19 +1,92 @@
 package eventsub_framework
 
-import "context"
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrIDReserved is returned by ReservingIDTracker.Reserve if the ID is
+// reserved by a message which is still being handled.
+var ErrIDReserved = errors.New("message id is reserved")
 
 type IDTracker interface {
 	// AddAndCheckIfDuplicate returns if the ID is a duplicate and an error.
 	AddAndCheckIfDuplicate(ctx context.Context, id string) (bool, error)
 }
 
+// RemovableIDTracker is an IDTracker which can remove an ID so that it is no
+// longer reported as a duplicate.
+type RemovableIDTracker interface {
+	IDTracker
+	// Remove removes the ID from the tracker.
+	Remove(ctx context.Context, id string) error
+}
+
+// ReservingIDTracker is an IDTracker which reserves an ID while its message is
+// handled, so that the ID is only marked as seen once the message has been
+// handled successfully.
+type ReservingIDTracker interface {
+	IDTracker
+	// Reserve reserves the ID, returning false if the ID has been committed.
+	// If the ID is reserved and not yet committed, Reserve returns false and
+	// ErrIDReserved. Reservations which are neither committed nor released
+	// expire, in case the process handling the message dies.
+	Reserve(ctx context.Context, id string) (bool, error)
+	// Commit marks a reserved ID as seen.
+	Commit(ctx context.Context, id string) error
+	// Release releases a reserved ID so that it can be reserved again.
+	Release(ctx context.Context, id string) error
+}
+
+// AdaptIDTracker returns tracker as a ReservingIDTracker. If it does not
+// implement ReservingIDTracker, Reserve marks the ID as seen immediately,
+// Commit does nothing, and Release removes the ID if tracker implements
+// RemovableIDTracker. Such a tracker cannot tell a reserved ID from a committed
+// one, so Reserve never returns ErrIDReserved.
+func AdaptIDTracker(tracker IDTracker) ReservingIDTracker {
+	if reserving, ok := tracker.(ReservingIDTracker); ok {
+		return reserving
+	}
+	return reservingAdapter{tracker}
+}
+
+type reservingAdapter struct {
+	IDTracker
+}
+
+func (a reservingAdapter) Reserve(ctx context.Context, id string) (bool, error) {
+	duplicate, err := a.AddAndCheckIfDuplicate(ctx, id)
+	return !duplicate, err
+}
+
+func (a reservingAdapter) Commit(context.Context, string) error {
+	return nil
+}
+
+func (a reservingAdapter) Release(ctx context.Context, id string) error {
+	if removable, ok := a.IDTracker.(RemovableIDTracker); ok {
+		return removable.Remove(ctx, id)
+	}
+	return nil
+}
+
 // MapTracker uses an in-memory map to check if a notification ID is
 // a duplicate.
+//
+// IDs are never forgotten, so a long-running process should use a TTLTracker
+// instead.
 type MapTracker struct {
+	mu   sync.Mutex
 	seen map[string]struct{}
 }
 
 func (m *MapTracker) AddAndCheckIfDuplicate(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	_, ok := m.seen[id]
 	if ok {
 		return true, nil
@@ -23,6 +96,14 @@ func (m *MapTracker) AddAndCheckIfDuplicate(_ context.Context, id string) (bool,
 	return false, nil
 }
 
+func (m *MapTracker) Remove(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.seen, id)
+	return nil
+}
+
 // NewMapTracker creates a new MapTracker instance which uses an in-memory map
 // to check if a notification ID is a duplicate.
 func NewMapTracker() *MapTracker {
@@ -30,3 +111,174 @@ func NewMapTracker() *MapTracker {
 		seen: make(map[string]struct{}),
 	}
 }
+
+// DefaultReservationTTL is how long a TTLTracker holds a reservation which is
+// neither committed nor released.
+const DefaultReservationTTL = time.Minute
+
+// TTLTracker uses an in-memory cache to check if a notification ID is a
+// duplicate. IDs expire once they have not been seen for the TTL, and the
+// least recently seen IDs are evicted when the cache is full.
+//
+// Twitch only redelivers a message for a limited time, and SubHandler rejects
+// messages older than its MaxMessageAge, so a TTL of MaxMessageAge is enough
+// to catch every duplicate.
+type TTLTracker struct {
+	ttl        time.Duration
+	maxEntries int
+
+	// How long a reservation is held before it expires.
+	ReservationTTL time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently seen at the front
+}
+
+type ttlEntry struct {
+	id       string
+	expires  time.Time
+	reserved bool
+}
+
+// NewTTLTracker creates a new TTLTracker which remembers IDs for ttl and holds
+// at most maxEntries IDs. If maxEntries is zero, the number of IDs is only
+// bounded by the TTL.
+func NewTTLTracker(ttl time.Duration, maxEntries int) *TTLTracker {
+	return &TTLTracker{
+		ttl:            ttl,
+		maxEntries:     maxEntries,
+		ReservationTTL: DefaultReservationTTL,
+		entries:        make(map[string]*list.Element),
+		order:          list.New(),
+	}
+}
+
+func (t *TTLTracker) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+func (t *TTLTracker) AddAndCheckIfDuplicate(_ context.Context, id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if elem := t.lookup(id, now); elem != nil {
+		entry := elem.Value.(*ttlEntry)
+		if !entry.reserved {
+			entry.expires = now.Add(t.ttl)
+			t.order.MoveToFront(elem)
+		}
+		return true, nil
+	}
+
+	t.add(id, now.Add(t.ttl), false)
+	return false, nil
+}
+
+func (t *TTLTracker) Reserve(_ context.Context, id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if elem := t.lookup(id, now); elem != nil {
+		if elem.Value.(*ttlEntry).reserved {
+			return false, ErrIDReserved
+		}
+		return false, nil
+	}
+
+	t.add(id, now.Add(t.ReservationTTL), true)
+	return true, nil
+}
+
+func (t *TTLTracker) Commit(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if elem := t.lookup(id, now); elem != nil {
+		entry := elem.Value.(*ttlEntry)
+		entry.reserved = false
+		entry.expires = now.Add(t.ttl)
+		t.order.MoveToFront(elem)
+	} else {
+		t.add(id, now.Add(t.ttl), false)
+	}
+	return nil
+}
+
+func (t *TTLTracker) Release(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elem, ok := t.entries[id]; ok && elem.Value.(*ttlEntry).reserved {
+		t.removeElement(elem)
+	}
+	return nil
+}
+
+func (t *TTLTracker) Remove(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elem, ok := t.entries[id]; ok {
+		t.removeElement(elem)
+	}
+	return nil
+}
+
+// lookup returns the element of the ID if it has not expired, after removing
+// the expired IDs.
+func (t *TTLTracker) lookup(id string, now time.Time) *list.Element {
+	t.expire(now)
+
+	elem, ok := t.entries[id]
+	if !ok {
+		return nil
+	} else if !now.Before(elem.Value.(*ttlEntry).expires) {
+		// A reservation may expire before IDs behind it in the list
+		t.removeElement(elem)
+		return nil
+	}
+	return elem
+}
+
+// add adds an ID which is not present to the front of the list, evicting the
+// least recently seen ID if the cache is full.
+func (t *TTLTracker) add(id string, expires time.Time, reserved bool) {
+	t.entries[id] = t.order.PushFront(&ttlEntry{id: id, expires: expires, reserved: reserved})
+	if t.maxEntries > 0 && t.order.Len() > t.maxEntries {
+		t.removeElement(t.order.Back())
+	}
+}
+
+// Len returns the number of IDs held, including expired IDs which have not yet
+// been removed.
+func (t *TTLTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.order.Len()
+}
+
+// expire removes the IDs which expired by now. Since IDs are ordered by when
+// they were last seen, they are mostly ordered by expiry, so expire stops at
+// the first ID which has not expired.
+func (t *TTLTracker) expire(now time.Time) {
+	for elem := t.order.Back(); elem != nil; elem = t.order.Back() {
+		if now.Before(elem.Value.(*ttlEntry).expires) {
+			return
+		}
+		t.removeElement(elem)
+	}
+}
+
+func (t *TTLTracker) removeElement(elem *list.Element) {
+	t.order.Remove(elem)
+	delete(t.entries, elem.Value.(*ttlEntry).id)
+}
@@ -0,0 +1,149 @@
+package eventsub_framework
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTrackerConcurrency adds each ID from many goroutines at once and checks
+// that exactly one of them sees it as new. Run with -race.
+func testTrackerConcurrency(t *testing.T, tracker IDTracker) {
+	const ids, goroutines = 100, 8
+	var added int64
+	var wg sync.WaitGroup
+
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ids; i++ {
+				duplicate, err := tracker.AddAndCheckIfDuplicate(context.Background(), fmt.Sprint(i))
+				assert.NoError(t, err)
+				if !duplicate {
+					atomic.AddInt64(&added, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(ids), added)
+}
+
+func TestMapTracker_Concurrent(t *testing.T) {
+	testTrackerConcurrency(t, NewMapTracker())
+}
+
+func TestTTLTracker_Concurrent(t *testing.T) {
+	testTrackerConcurrency(t, NewTTLTracker(time.Minute, 1000))
+}
+
+func TestTTLTracker_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker := NewTTLTracker(10*time.Minute, 0)
+	tracker.Clock = func() time.Time { return now }
+
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+
+	now = now.Add(9 * time.Minute)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.True(t, duplicate)
+
+	// Seeing an ID again extends its expiry
+	now = now.Add(9 * time.Minute)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.False(t, duplicate)
+	assert.Equal(t, 2, tracker.Len())
+
+	now = now.Add(10 * time.Minute)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+	assert.Equal(t, 1, tracker.Len())
+}
+
+func TestTTLTracker_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTTLTracker(time.Minute, 2)
+
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a") // a is now most recently seen
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "c") // evicts b
+
+	assert.Equal(t, 2, tracker.Len())
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.True(t, duplicate)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.False(t, duplicate)
+}
+
+func TestTTLTracker_Remove(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTTLTracker(time.Minute, 0)
+
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, tracker.Remove(ctx, "a"))
+
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+}
+
+func TestTTLTracker_Reserve(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker := NewTTLTracker(10*time.Minute, 0)
+	tracker.Clock = func() time.Time { return now }
+
+	reserved, _ := tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+	reserved, err := tracker.Reserve(ctx, "a")
+	assert.False(t, reserved, "reserved ID was reserved again")
+	assert.ErrorIs(t, err, ErrIDReserved)
+
+	assert.NoError(t, tracker.Release(ctx, "a"))
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+
+	assert.NoError(t, tracker.Commit(ctx, "a"))
+	assert.NoError(t, tracker.Release(ctx, "a")) // committed IDs are not released
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.NoError(t, err)
+
+	// Reservations expire before committed IDs
+	reserved, _ = tracker.Reserve(ctx, "b")
+	assert.True(t, reserved)
+	now = now.Add(DefaultReservationTTL)
+	reserved, _ = tracker.Reserve(ctx, "b")
+	assert.True(t, reserved)
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+}
+
+func TestAdaptIDTracker(t *testing.T) {
+	ctx := context.Background()
+	tracker := AdaptIDTracker(NewMapTracker())
+
+	reserved, _ := tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+
+	// Release removes the ID from a RemovableIDTracker
+	assert.NoError(t, tracker.Release(ctx, "a"))
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+
+	ttlTracker := NewTTLTracker(time.Minute, 0)
+	assert.Same(t, ttlTracker, AdaptIDTracker(ttlTracker))
+}
@@ -0,0 +1,102 @@
+package eventsub_framework
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// KeyFunc returns the key used to order a message. Messages with an empty key
+// are not ordered.
+type KeyFunc func(d *Delivery) string
+
+// BroadcasterKey is a KeyFunc which returns the broadcaster_user_id of the
+// subscription condition, or else of the event.
+func BroadcasterKey(d *Delivery) string {
+	if condition, ok := d.Subscription.Condition.(map[string]interface{}); ok {
+		if id, ok := condition["broadcaster_user_id"].(string); ok && id != "" {
+			return id
+		}
+	}
+
+	if len(d.Event) == 0 {
+		return ""
+	}
+	var event struct {
+		BroadcasterUserID string `json:"broadcaster_user_id"`
+	}
+	if err := json.Unmarshal(d.Event, &event); err != nil {
+		return ""
+	}
+	return event.BroadcasterUserID
+}
+
+// OrderedDispatcher is a Dispatcher which runs the tasks of messages with the
+// same key one at a time, in the order they were received, while tasks of
+// messages with different keys run in parallel.
+//
+// Each key with pending tasks has its own goroutine, which exits once the key
+// is idle.
+type OrderedDispatcher struct {
+	key KeyFunc
+
+	mu     sync.Mutex
+	queues map[string][]func()
+}
+
+// NewOrderedDispatcher creates a new OrderedDispatcher which orders messages
+// by the key returned by key. If key is nil, BroadcasterKey is used.
+func NewOrderedDispatcher(key KeyFunc) *OrderedDispatcher {
+	if key == nil {
+		key = BroadcasterKey
+	}
+	return &OrderedDispatcher{
+		key:    key,
+		queues: make(map[string][]func()),
+	}
+}
+
+// Dispatch queues task behind the pending tasks with the same key. If the key
+// is empty, task is run in a new goroutine.
+func (o *OrderedDispatcher) Dispatch(d *Delivery, task func()) error {
+	key := o.key(d)
+	if key == "" {
+		go task()
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	queue, running := o.queues[key]
+	o.queues[key] = append(queue, task)
+	if !running {
+		go o.run(key)
+	}
+	return nil
+}
+
+// run runs the tasks queued for key until there are none left.
+func (o *OrderedDispatcher) run(key string) {
+	for {
+		o.mu.Lock()
+		queue := o.queues[key]
+		if len(queue) == 0 {
+			delete(o.queues, key)
+			o.mu.Unlock()
+			return
+		}
+		task := queue[0]
+		queue[0] = nil
+		o.queues[key] = queue[1:]
+		o.mu.Unlock()
+
+		task()
+	}
+}
+
+// ActiveKeys returns the number of keys with pending tasks.
+func (o *OrderedDispatcher) ActiveKeys() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queues)
+}
@@ -0,0 +1,79 @@
+package eventsub_framework
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKeyedDelivery(broadcasterUserID string) *Delivery {
+	return &Delivery{
+		Headers: &esb.ResponseHeaders{},
+		Subscription: esb.Subscription{
+			Condition: map[string]interface{}{"broadcaster_user_id": broadcasterUserID},
+		},
+	}
+}
+
+func TestOrderedDispatcher(t *testing.T) {
+	dispatcher := NewOrderedDispatcher(nil)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+
+	release := make(chan struct{})
+	otherDone := newDispatcher(1)
+
+	wg.Add(101)
+	_ = dispatcher.Dispatch(newKeyedDelivery("1337"), func() {
+		defer wg.Done()
+		<-release
+	})
+	for i := 0; i < 100; i++ {
+		i := i
+		_ = dispatcher.Dispatch(newKeyedDelivery("1337"), func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+
+	// Other keys are not blocked
+	_ = dispatcher.Dispatch(newKeyedDelivery("42"), otherDone.Trigger)
+	assert.True(t, otherDone.WaitForTrigger(100*time.Millisecond), "task for other key did not run")
+
+	close(release)
+	wg.Wait()
+
+	expected := make([]int, 100)
+	for i := range expected {
+		expected[i] = i
+	}
+	assert.Equal(t, expected, order)
+
+	// Idle keys are removed
+	assert.Eventually(t, func() bool {
+		return dispatcher.ActiveKeys() == 0
+	}, 100*time.Millisecond, time.Millisecond)
+}
+
+func TestBroadcasterKey(t *testing.T) {
+	assert.Equal(t, "1337", BroadcasterKey(newKeyedDelivery("1337")))
+
+	// Falls back to the event for conditions without a broadcaster
+	d := &Delivery{
+		Subscription: esb.Subscription{
+			Condition: map[string]interface{}{"to_broadcaster_user_id": "1337"},
+		},
+		Event: json.RawMessage(`{"broadcaster_user_id":"42"}`),
+	}
+	assert.Equal(t, "42", BroadcasterKey(d))
+
+	assert.Equal(t, "", BroadcasterKey(&Delivery{}))
+}
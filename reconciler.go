@@ -0,0 +1,451 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// ActionKind is the kind of change a Reconciler makes to a subscription.
+type ActionKind string
+
+const (
+	// ActionCreate creates a desired subscription which does not exist.
+	ActionCreate ActionKind = "create"
+	// ActionDelete deletes an owned subscription which is not desired, or a
+	// duplicate of a desired subscription.
+	ActionDelete ActionKind = "delete"
+	// ActionRecreate deletes a desired subscription which can no longer be
+	// delivered, such as one whose authorization was revoked, and creates it
+	// again.
+	ActionRecreate ActionKind = "recreate"
+)
+
+// Action is a change a Reconciler makes to converge to the desired
+// subscriptions.
+type Action struct {
+	Kind ActionKind
+	// The desired subscription to create. Nil for ActionDelete.
+	Desired *SubRequest
+	// The existing subscription to delete. Nil for ActionCreate.
+	Existing *ExistingSubscription
+}
+
+func (a *Action) String() string {
+	if a.Existing == nil {
+		return fmt.Sprintf("%s %s", a.Kind, describeRequest(a.Desired))
+	}
+
+	sub := a.Existing
+	condition, _ := conditionValues(sub.Condition)
+	return fmt.Sprintf("%s %s %s v%s %s via %s (%s)",
+		a.Kind, sub.ID, sub.Type, sub.Version, formatConditionValues(condition),
+		describeTransport(sub.Transport), sub.Status)
+}
+
+// Plan is the list of actions a Reconciler takes to converge to the desired
+// subscriptions.
+type Plan []Action
+
+// String returns one line per action, for printing a dry run.
+func (p Plan) String() string {
+	if len(p) == 0 {
+		return "no changes"
+	}
+
+	lines := make([]string, len(p))
+	for i := range p {
+		lines[i] = p[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ActionResult is the result of applying an Action.
+type ActionResult struct {
+	Action
+	// The created subscription, for ActionCreate and ActionRecreate.
+	Subscription *esb.Subscription
+	// Why the action failed, if it did.
+	Err error
+}
+
+// Reconciler converges the subscriptions of an app to a desired set of
+// subscriptions. It creates desired subscriptions which do not exist,
+// recreates desired subscriptions which can no longer be delivered, and
+// deletes owned subscriptions which are not desired.
+//
+// An existing subscription is the desired subscription if it has the same
+// type, version and condition, and is delivered to the same callback or
+// conduit. Empty condition values are ignored, and so is the secret of a
+// webhook.
+//
+// Subscriptions using the WebSocket transport cannot be reconciled, since
+// they are listed and deleted with a user token and end with their session.
+//
+// Reconcile may be called on demand while Run is running; reconciliations do
+// not overlap.
+type Reconciler struct {
+	client *SubClient
+
+	// Owns reports whether the app owns an existing subscription which is
+	// not desired, so that the Reconciler deletes it. If nil, the app owns
+	// the subscriptions delivered to the transport of a desired subscription.
+	Owns func(sub *ExistingSubscription) bool
+	// Called with the result of each applied action.
+	OnResult func(result *ActionResult)
+
+	mu      sync.Mutex
+	desired []SubRequest
+
+	reconcileMu sync.Mutex
+}
+
+// NewReconciler creates a new Reconciler which converges the subscriptions of
+// the client to the desired subscriptions. An error is returned if a desired
+// subscription has an invalid transport or uses the WebSocket transport.
+func NewReconciler(client *SubClient, desired []SubRequest) (*Reconciler, error) {
+	r := &Reconciler{client: client}
+	if err := r.SetDesired(desired); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetDesired replaces the desired subscriptions, which take effect from the
+// next reconciliation. An error is returned, and the desired subscriptions
+// are unchanged, if a desired subscription has an invalid transport or uses
+// the WebSocket transport.
+func (r *Reconciler) SetDesired(desired []SubRequest) error {
+	for i := range desired {
+		transport, err := desired[i].transport()
+		if err != nil {
+			return fmt.Errorf("desired %s: %w", desired[i].Type, err)
+		} else if transport.Method == TransportWebSocket {
+			return fmt.Errorf("desired %s: websocket transport cannot be reconciled", desired[i].Type)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.desired = append([]SubRequest(nil), desired...)
+	return nil
+}
+
+// desiredSubscription is a desired subscription normalized for comparison.
+type desiredSubscription struct {
+	request   *SubRequest
+	condition map[string]string
+	transport *requestTransport
+}
+
+func (d *desiredSubscription) matches(sub *ExistingSubscription, condition map[string]string) bool {
+	return sub.Type == d.request.Type &&
+		sub.Version == d.request.Version &&
+		equalConditions(condition, d.condition) &&
+		d.deliversTo(sub.Transport)
+}
+
+func (d *desiredSubscription) deliversTo(t SubscriptionTransport) bool {
+	return t.Method == d.transport.Method &&
+		t.Callback == d.transport.Callback &&
+		t.SessionID == d.transport.SessionID &&
+		t.ConduitID == d.transport.ConduitID
+}
+
+// Plan compares the existing subscriptions to the desired subscriptions and
+// returns the actions which would converge them, without applying them.
+func (r *Reconciler) Plan(ctx context.Context) (Plan, error) {
+	desired, err := r.normalizedDesired()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := r.client.listSubscriptions(ctx, StatusAny)
+	if err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+	return r.plan(desired, existing.Data)
+}
+
+func (r *Reconciler) normalizedDesired() ([]desiredSubscription, error) {
+	r.mu.Lock()
+	requests := append([]SubRequest(nil), r.desired...)
+	r.mu.Unlock()
+
+	desired := make([]desiredSubscription, len(requests))
+	for i := range requests {
+		srq := &requests[i]
+		if srq.Version == "" {
+			srq.Version = "1"
+		}
+
+		condition, err := conditionValues(srq.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("plan: condition of %s: %w", srq.Type, err)
+		}
+		transport, err := srq.transport()
+		if err != nil {
+			return nil, fmt.Errorf("plan: transport of %s: %w", srq.Type, err)
+		}
+		desired[i] = desiredSubscription{
+			request:   srq,
+			condition: condition,
+			transport: transport,
+		}
+	}
+	return desired, nil
+}
+
+func (r *Reconciler) plan(desired []desiredSubscription, existing []ExistingSubscription) (Plan, error) {
+	// Existing subscriptions matching each desired subscription
+	matches := make([][]*ExistingSubscription, len(desired))
+	var plan Plan
+
+	for i := range existing {
+		sub := &existing[i]
+		condition, err := conditionValues(sub.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("plan: condition of %s: %w", sub.ID, err)
+		}
+
+		matched := false
+		for j := range desired {
+			if desired[j].matches(sub, condition) {
+				matches[j] = append(matches[j], sub)
+				matched = true
+				break
+			}
+		}
+		if !matched && r.owns(desired, sub) {
+			plan = append(plan, Action{Kind: ActionDelete, Existing: sub})
+		}
+	}
+
+	for i := range desired {
+		plan = append(plan, planDesired(&desired[i], matches[i])...)
+	}
+	return plan, nil
+}
+
+// planDesired returns the actions for a desired subscription given the
+// existing subscriptions matching it. One healthy subscription is kept and
+// the rest are deleted. If none are healthy, an unhealthy one is recreated.
+func planDesired(desired *desiredSubscription, matches []*ExistingSubscription) []Action {
+	if len(matches) == 0 {
+		return []Action{{Kind: ActionCreate, Desired: desired.request}}
+	}
+
+	keep := -1
+	for i, sub := range matches {
+		if isDeliverableStatus(Status(sub.Status)) {
+			keep = i
+			break
+		}
+	}
+
+	var actions []Action
+	if keep == -1 {
+		keep = 0
+		actions = append(actions, Action{Kind: ActionRecreate, Desired: desired.request, Existing: matches[0]})
+	}
+	for i, sub := range matches {
+		if i != keep {
+			actions = append(actions, Action{Kind: ActionDelete, Existing: sub})
+		}
+	}
+	return actions
+}
+
+// isDeliverableStatus reports whether a subscription with the status is, or
+// will be once verified, delivered.
+func isDeliverableStatus(status Status) bool {
+	return status == StatusEnabled || status == StatusVerificationPending
+}
+
+func (r *Reconciler) owns(desired []desiredSubscription, sub *ExistingSubscription) bool {
+	if r.Owns != nil {
+		return r.Owns(sub)
+	}
+	for i := range desired {
+		if desired[i].deliversTo(sub.Transport) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply applies the actions of a plan in order and returns their results.
+// Every action is attempted even if some fail.
+func (r *Reconciler) Apply(ctx context.Context, plan Plan) []ActionResult {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+	return r.apply(ctx, plan)
+}
+
+func (r *Reconciler) apply(ctx context.Context, plan Plan) []ActionResult {
+	results := make([]ActionResult, len(plan))
+	for i := range plan {
+		result := &results[i]
+		result.Action = plan[i]
+		result.Subscription, result.Err = r.applyAction(ctx, &plan[i])
+		if r.OnResult != nil {
+			r.OnResult(result)
+		}
+	}
+	return results
+}
+
+func (r *Reconciler) applyAction(ctx context.Context, action *Action) (*esb.Subscription, error) {
+	if action.Existing != nil {
+		if err := r.client.Unsubscribe(ctx, action.Existing.ID); err != nil {
+			return nil, err
+		}
+	}
+	if action.Desired == nil {
+		return nil, nil
+	}
+
+	// Subscribe sets the default version of its request
+	srq := *action.Desired
+	res, err := r.client.Subscribe(ctx, &srq)
+	if err != nil {
+		return nil, err
+	} else if len(res.Data) == 0 {
+		return nil, errors.New("subscribe: no subscription in response")
+	}
+	return &res.Data[0], nil
+}
+
+// Reconcile plans and applies the actions which converge to the desired
+// subscriptions, and returns their results. The error is non-nil if the plan
+// failed or any action failed.
+func (r *Reconciler) Reconcile(ctx context.Context) ([]ActionResult, error) {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+
+	plan, err := r.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := r.apply(ctx, plan)
+	failed := 0
+	for i := range results {
+		if results[i].Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("reconcile: %d of %d actions failed", failed, len(results))
+	}
+	return results, nil
+}
+
+// Run reconciles immediately and then at the given interval until the context
+// is done, then returns the context's error. Errors from Reconcile are passed
+// to onError if it is non-nil.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration, onError func(err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// conditionValues returns the non-empty values of a condition, which may be
+// a map or a condition struct.
+func conditionValues(condition interface{}) (map[string]string, error) {
+	b, err := json.Marshal(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(fields))
+	for key, value := range fields {
+		switch v := value.(type) {
+		case nil:
+			// Unset, like an empty string
+		case string:
+			if v != "" {
+				values[key] = v
+			}
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+func equalConditions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// formatConditionValues formats a condition as sorted key=value pairs.
+func formatConditionValues(condition map[string]string) string {
+	pairs := make([]string, 0, len(condition))
+	for key, value := range condition {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func describeRequest(srq *SubRequest) string {
+	version := srq.Version
+	if version == "" {
+		version = "1"
+	}
+	condition, _ := conditionValues(srq.Condition)
+
+	var transport SubscriptionTransport
+	if t, err := srq.transport(); err == nil {
+		transport = SubscriptionTransport{
+			Method:    t.Method,
+			Callback:  t.Callback,
+			SessionID: t.SessionID,
+			ConduitID: t.ConduitID,
+		}
+	}
+	return fmt.Sprintf("%s v%s %s via %s", srq.Type, version, formatConditionValues(condition), describeTransport(transport))
+}
+
+func describeTransport(t SubscriptionTransport) string {
+	switch t.Method {
+	case TransportWebhook:
+		return "webhook " + t.Callback
+	case TransportWebSocket:
+		return "websocket " + t.SessionID
+	case TransportConduit:
+		return "conduit " + t.ConduitID
+	default:
+		return t.Method
+	}
+}
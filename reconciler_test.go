@@ -0,0 +1,274 @@
+package eventsub_framework_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	esf "github.com/dnsge/twitch-eventsub-framework"
+	"github.com/dnsge/twitch-eventsub-framework/eventsubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// The reconciler tests use the eventsubtest server, which imports this
+// package, so they are in an external test package.
+
+const reconcilerSecret = "s3cRe7s3cRe7"
+
+func newReconcilerTest(t *testing.T) (*eventsubtest.Server, *esf.SubClient, string) {
+	server := eventsubtest.NewServer()
+	t.Cleanup(server.Close)
+
+	callback := httptest.NewServer(esf.NewSubHandler(true, []byte(reconcilerSecret)))
+	t.Cleanup(callback.Close)
+
+	client := esf.NewSubClientURL(
+		esf.NewStaticCredentials("client-id", "app-token"),
+		http.DefaultClient,
+		server.URL,
+	)
+	return server, client, callback.URL
+}
+
+func newReconciler(t *testing.T, client *esf.SubClient, desired []esf.SubRequest) *esf.Reconciler {
+	reconciler, err := esf.NewReconciler(client, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reconciler
+}
+
+func desiredSubscriptions(callback string) []esf.SubRequest {
+	return []esf.SubRequest{
+		{
+			Type:      "channel.update",
+			Version:   "2",
+			Condition: &esf.ConditionChannelUpdateV2{BroadcasterUserID: "1337"},
+			Callback:  callback,
+			Secret:    reconcilerSecret,
+		},
+		{
+			Type:      "stream.online",
+			Condition: map[string]string{"broadcaster_user_id": "1337"},
+			ConduitID: "conduit-id",
+		},
+	}
+}
+
+func actionKinds(plan esf.Plan) []esf.ActionKind {
+	kinds := make([]esf.ActionKind, len(plan))
+	for i := range plan {
+		kinds[i] = plan[i].Kind
+	}
+	return kinds
+}
+
+func TestReconciler_CreateAndConverge(t *testing.T) {
+	ctx := context.Background()
+	server, client, callback := newReconcilerTest(t)
+	reconciler := newReconciler(t, client, desiredSubscriptions(callback))
+
+	plan, err := reconciler.Plan(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []esf.ActionKind{esf.ActionCreate, esf.ActionCreate}, actionKinds(plan))
+	assert.Equal(t,
+		"create channel.update v2 {broadcaster_user_id=1337} via webhook "+callback+"\n"+
+			"create stream.online v1 {broadcaster_user_id=1337} via conduit conduit-id",
+		plan.String())
+	assert.Empty(t, server.Subscriptions(), "planning must not change subscriptions")
+
+	var reported []*esf.ActionResult
+	reconciler.OnResult = func(result *esf.ActionResult) {
+		reported = append(reported, result)
+	}
+
+	results, err := reconciler.Reconcile(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+			assert.NotNil(t, result.Subscription)
+		}
+	}
+	assert.Len(t, reported, 2)
+
+	subs := server.Subscriptions()
+	if assert.Len(t, subs, 2) {
+		assert.Equal(t, esf.StatusEnabled, subs[0].Status)
+		assert.Equal(t, "2", subs[0].Version)
+		assert.Equal(t, "conduit-id", subs[1].Transport.ConduitID)
+	}
+
+	plan, err = reconciler.Plan(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, plan)
+	assert.Equal(t, "no changes", plan.String())
+}
+
+func TestReconciler_RecreateFailed(t *testing.T) {
+	ctx := context.Background()
+	server, client, callback := newReconcilerTest(t)
+	reconciler := newReconciler(t, client, desiredSubscriptions(callback))
+	if _, err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := server.Subscriptions()[0]
+	server.SetStatus(revoked.ID, esf.StatusAuthorizationRevoked)
+
+	plan, err := reconciler.Plan(ctx)
+	assert.NoError(t, err)
+	if assert.Equal(t, []esf.ActionKind{esf.ActionRecreate}, actionKinds(plan)) {
+		assert.Equal(t, revoked.ID, plan[0].Existing.ID)
+		assert.Contains(t, plan[0].String(), "(authorization_revoked)")
+	}
+
+	results := reconciler.Apply(ctx, plan)
+	if assert.Len(t, results, 1) && assert.NoError(t, results[0].Err) {
+		assert.NotEqual(t, revoked.ID, results[0].Subscription.ID)
+	}
+
+	_, ok := server.Subscription(revoked.ID)
+	assert.False(t, ok)
+	for _, sub := range server.Subscriptions() {
+		assert.Equal(t, esf.StatusEnabled, sub.Status)
+	}
+}
+
+func TestReconciler_DeleteOwnedExtras(t *testing.T) {
+	ctx := context.Background()
+	server, client, callback := newReconcilerTest(t)
+	desired := desiredSubscriptions(callback)
+	if _, err := newReconciler(t, client, desired).Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe := func(srq esf.SubRequest) string {
+		res, err := client.Subscribe(ctx, &srq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Data[0].ID
+	}
+	// Delivered to a desired transport, so owned
+	extra := subscribe(esf.SubRequest{
+		Type:      "stream.offline",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		ConduitID: "conduit-id",
+	})
+	// Delivered elsewhere, so owned by another app
+	foreign := subscribe(esf.SubRequest{
+		Type:      "stream.offline",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		ConduitID: "other-conduit-id",
+	})
+	// A failed duplicate of a desired subscription
+	duplicate := subscribe(esf.SubRequest{
+		Type:      "stream.online",
+		Condition: map[string]string{"broadcaster_user_id": "1337", "unused": ""},
+		ConduitID: "conduit-id",
+		Version:   "1",
+	})
+	server.SetStatus(duplicate, esf.StatusFailuresExceeded)
+
+	reconciler := newReconciler(t, client, desired)
+	plan, err := reconciler.Plan(ctx)
+	assert.NoError(t, err)
+	deleted := make(map[string]bool)
+	for _, action := range plan {
+		assert.Equal(t, esf.ActionDelete, action.Kind)
+		deleted[action.Existing.ID] = true
+	}
+	assert.Equal(t, map[string]bool{extra: true, duplicate: true}, deleted)
+
+	_, err = reconciler.Reconcile(ctx)
+	assert.NoError(t, err)
+	_, ok := server.Subscription(foreign)
+	assert.True(t, ok)
+	assert.Len(t, server.Subscriptions(), 3)
+
+	// Owns decides which subscriptions which are not desired are deleted
+	assert.NoError(t, reconciler.SetDesired(nil))
+	reconciler.Owns = func(sub *esf.ExistingSubscription) bool {
+		return sub.Transport.ConduitID == "other-conduit-id"
+	}
+	plan, err = reconciler.Plan(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, plan, 1) {
+		assert.Equal(t, foreign, plan[0].Existing.ID)
+	}
+}
+
+func TestReconciler_RejectWebSocket(t *testing.T) {
+	_, client, callback := newReconcilerTest(t)
+	websocket := esf.SubRequest{
+		Type:      "stream.online",
+		Condition: map[string]string{"broadcaster_user_id": "1337"},
+		SessionID: "session-id",
+	}
+
+	_, err := esf.NewReconciler(client, []esf.SubRequest{websocket})
+	assert.EqualError(t, err, "desired stream.online: websocket transport cannot be reconciled")
+
+	reconciler := newReconciler(t, client, desiredSubscriptions(callback))
+	assert.Error(t, reconciler.SetDesired(append(desiredSubscriptions(callback), websocket)))
+	plan, err := reconciler.Plan(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, plan, 2, "desired subscriptions must be unchanged")
+}
+
+func TestReconciler_ActionFailed(t *testing.T) {
+	ctx := context.Background()
+	server, client, callback := newReconcilerTest(t)
+	server.MaxTotalCost = 1
+
+	reconciler := newReconciler(t, client, desiredSubscriptions(callback))
+	results, err := reconciler.Reconcile(ctx)
+	assert.EqualError(t, err, "reconcile: 1 of 2 actions failed")
+	if assert.Len(t, results, 2) {
+		assert.NoError(t, results[0].Err)
+		var twitchErr *esf.TwitchError
+		if assert.True(t, errors.As(results[1].Err, &twitchErr)) {
+			assert.Equal(t, http.StatusTooManyRequests, twitchErr.Status)
+		}
+	}
+}
+
+func TestReconciler_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, client, callback := newReconcilerTest(t)
+
+	created := make(chan *esb.Subscription, 4)
+	reconciler := newReconciler(t, client, desiredSubscriptions(callback)[1:])
+	reconciler.OnResult = func(result *esf.ActionResult) {
+		created <- result.Subscription
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- reconciler.Run(ctx, 10*time.Millisecond, func(err error) {
+			t.Errorf("reconcile failed: %v", err)
+		})
+	}()
+
+	// Created immediately, then recreated after being revoked
+	first := <-created
+	server.SetStatus(first.ID, esf.StatusAuthorizationRevoked)
+	select {
+	case second := <-created:
+		assert.NotEqual(t, first.ID, second.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("revoked subscription was not recreated")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Len(t, server.Subscriptions(), 1)
+}
@@ -0,0 +1,267 @@
+package eventsub_framework
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRedisKeyPrefix is the prefix of the keys used by a RedisTracker if
+// none is given.
+const DefaultRedisKeyPrefix = "eventsub:message:"
+
+// Values of RedisTracker keys.
+const (
+	redisCommitted = "1"
+	redisReserved  = "reserved"
+)
+
+// redisReleaseScript deletes a key only if it holds a reservation, so that a
+// release cannot remove an ID which was committed.
+const redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// redisMaxIdleConns is the number of idle connections a RedisTracker keeps
+// for reuse.
+const redisMaxIdleConns = 4
+
+// RedisError is an error reply from a Redis server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// RedisTracker is a ReservingIDTracker which stores IDs in Redis, or any
+// server speaking the Redis protocol, so that duplicates are detected across
+// every process sharing the server. Each ID is stored with SET NX EX so that it
+// expires after the TTL. Releasing a reservation runs a Lua script, so the
+// server must support EVAL.
+type RedisTracker struct {
+	addr   string
+	prefix string
+	ttl    time.Duration
+
+	// How long a reservation is held before it expires. It is rounded up to
+	// whole seconds.
+	ReservationTTL time.Duration
+	// Password sent with AUTH on each new connection, if non-empty.
+	Password string
+	// Dialer used to connect to the server.
+	Dialer net.Dialer
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// NewRedisTracker creates a new RedisTracker which stores IDs at the server
+// with the given address under keys with the given prefix. If prefix is empty,
+// DefaultRedisKeyPrefix is used. The TTL is rounded up to whole seconds.
+func NewRedisTracker(addr, prefix string, ttl time.Duration) *RedisTracker {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisTracker{
+		addr:           addr,
+		prefix:         prefix,
+		ttl:            ttl,
+		ReservationTTL: DefaultReservationTTL,
+	}
+}
+
+func (t *RedisTracker) AddAndCheckIfDuplicate(ctx context.Context, id string) (bool, error) {
+	reply, err := t.do(ctx, "SET", t.prefix+id, redisCommitted, "NX", "EX", redisSeconds(t.ttl))
+	if err != nil {
+		return false, err
+	}
+	// SET NX replies OK if the key was set and nil if it already exists
+	return reply == nil, nil
+}
+
+func (t *RedisTracker) Reserve(ctx context.Context, id string) (bool, error) {
+	reply, err := t.do(ctx, "SET", t.prefix+id, redisReserved, "NX", "EX", redisSeconds(t.ReservationTTL))
+	if err != nil {
+		return false, err
+	} else if reply != nil {
+		return true, nil
+	}
+
+	value, err := t.do(ctx, "GET", t.prefix+id)
+	if err != nil {
+		return false, err
+	} else if value == redisCommitted {
+		return false, nil
+	}
+	// The key is reserved, or the reservation ended since it was set
+	return false, ErrIDReserved
+}
+
+func (t *RedisTracker) Commit(ctx context.Context, id string) error {
+	_, err := t.do(ctx, "SET", t.prefix+id, redisCommitted, "EX", redisSeconds(t.ttl))
+	return err
+}
+
+func (t *RedisTracker) Release(ctx context.Context, id string) error {
+	_, err := t.do(ctx, "EVAL", redisReleaseScript, "1", t.prefix+id, redisReserved)
+	return err
+}
+
+func (t *RedisTracker) Remove(ctx context.Context, id string) error {
+	_, err := t.do(ctx, "DEL", t.prefix+id)
+	return err
+}
+
+// redisSeconds returns a duration for EX, rounded up to whole seconds.
+func redisSeconds(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// Close closes the idle connections to the server.
+func (t *RedisTracker) Close() error {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+
+	for _, conn := range idle {
+		_ = conn.Close()
+	}
+	return nil
+}
+
+// do sends a command on a pooled connection and returns its reply. An error
+// reply is returned as a RedisError.
+func (t *RedisTracker) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := t.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state
+		_ = conn.Close()
+		return nil, err
+	}
+	t.put(conn)
+	return reply, err
+}
+
+// get returns an idle connection, or else dials a new one.
+func (t *RedisTracker) get(ctx context.Context) (*redisConn, error) {
+	t.mu.Lock()
+	if n := len(t.idle); n > 0 {
+		conn := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.mu.Unlock()
+		return conn, nil
+	}
+	t.mu.Unlock()
+
+	netConn, err := t.Dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+
+	if t.Password != "" {
+		if _, err := conn.do(ctx, "AUTH", t.Password); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool.
+func (t *RedisTracker) put(conn *redisConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.idle) >= redisMaxIdleConns {
+		_ = conn.Close()
+		return
+	}
+	t.idle = append(t.idle, conn)
+}
+
+// redisConn is a connection to a server speaking the Redis protocol.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline() // no deadline if zero
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.Write(encodeRedisCommand(args)); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.reader)
+}
+
+// encodeRedisCommand encodes a command as an array of bulk strings.
+func encodeRedisCommand(args []string) []byte {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// readRedisReply reads a reply other than an array. Simple and bulk strings
+// are returned as strings, integers as int64, nulls as nil, and errors as
+// RedisError.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, RedisError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		} else if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+}
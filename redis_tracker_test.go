@@ -0,0 +1,248 @@
+package eventsub_framework
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is an in-process server speaking enough of the Redis protocol for
+// RedisTracker.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	keys     map[string]time.Duration // key to TTL
+	values   map[string]string
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	s := &fakeRedis{
+		listener: listener,
+		password: password,
+		keys:     make(map[string]time.Duration),
+		values:   make(map[string]string),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == s.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SET" && (len(args) == 5 || len(args) == 6):
+			seconds, _ := strconv.Atoi(args[len(args)-1])
+			if _, ok := s.keys[args[1]]; ok && len(args) == 6 {
+				reply = "$-1\r\n"
+			} else {
+				s.keys[args[1]] = time.Duration(seconds) * time.Second
+				s.values[args[1]] = args[2]
+				reply = "+OK\r\n"
+			}
+		case cmd == "GET":
+			reply = "$-1\r\n"
+			if value, ok := s.values[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			}
+		case cmd == "DEL":
+			reply = s.del(args[1])
+		case cmd == "EVAL" && args[1] == redisReleaseScript:
+			reply = ":0\r\n"
+			if s.values[args[3]] == args[4] {
+				reply = s.del(args[3])
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) del(key string) string {
+	_, ok := s.keys[key]
+	delete(s.keys, key)
+	delete(s.values, key)
+	if ok {
+		return ":1\r\n"
+	}
+	return ":0\r\n"
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisTracker(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	tracker := NewRedisTracker(server.addr(), "test:", 10*time.Minute)
+	defer tracker.Close()
+
+	duplicate, err := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	assert.NoError(t, tracker.Remove(ctx, "a"))
+	duplicate, err = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{"SET", "test:a", "1", "NX", "EX", "600"}, server.commands[0])
+	assert.Equal(t, 10*time.Minute, server.keys["test:a"])
+}
+
+func TestRedisTracker_Reserve(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	tracker := NewRedisTracker(server.addr(), "test:", 10*time.Minute)
+	defer tracker.Close()
+
+	reserved, err := tracker.Reserve(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.ErrorIs(t, err, ErrIDReserved)
+
+	assert.NoError(t, tracker.Release(ctx, "a"))
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+
+	assert.NoError(t, tracker.Commit(ctx, "a"))
+	assert.NoError(t, tracker.Release(ctx, "a")) // committed IDs are not released
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{"SET", "test:a", "reserved", "NX", "EX", "60"}, server.commands[0])
+	assert.Equal(t, 10*time.Minute, server.keys["test:a"])
+}
+
+func TestRedisTracker_Auth(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "hunter2")
+
+	tracker := NewRedisTracker(server.addr(), "", time.Minute)
+	defer tracker.Close()
+	_, err := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.Equal(t, RedisError("NOAUTH Authentication required."), err)
+
+	tracker = NewRedisTracker(server.addr(), "", time.Minute)
+	tracker.Password = "hunter2"
+	defer tracker.Close()
+	duplicate, err := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Contains(t, server.keys, DefaultRedisKeyPrefix+"a")
+}
+
+func TestRedisTracker_ConnectionError(t *testing.T) {
+	server := newFakeRedis(t, "")
+	_ = server.listener.Close()
+
+	tracker := NewRedisTracker(server.addr(), "", time.Minute)
+	defer tracker.Close()
+
+	duplicate, err := tracker.AddAndCheckIfDuplicate(context.Background(), "a")
+	assert.Error(t, err)
+	assert.False(t, duplicate)
+
+	// The error fails the request so that Twitch delivers it again
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.IDTracker = tracker
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
+
+func TestRedisTracker_Concurrent(t *testing.T) {
+	server := newFakeRedis(t, "")
+	tracker := NewRedisTracker(server.addr(), "", time.Minute)
+	defer tracker.Close()
+
+	testTrackerConcurrency(t, tracker)
+}
@@ -0,0 +1,272 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// Delivery describes a received notification.
+//
+// A Delivery given to a Dispatcher may also describe a revocation, with only
+// Headers and Subscription set, or a duplicate notification, with only Headers
+// set.
+type Delivery struct {
+	// Headers of the notification. For the WebSocket transport, these are
+	// populated from the message metadata.
+	Headers *esb.ResponseHeaders
+	// The subscription that the notification was sent for.
+	Subscription esb.Subscription
+	// The raw event payload.
+	Event json.RawMessage
+
+	ctx             context.Context
+	rawSubscription json.RawMessage
+}
+
+// rawNotification is the body of a notification message.
+type rawNotification struct {
+	Subscription json.RawMessage `json:"subscription"`
+	Event        json.RawMessage `json:"event"`
+}
+
+// decodeDelivery decodes the body of a notification message received with
+// the given context.
+func decodeDelivery(ctx context.Context, h *esb.ResponseHeaders, body []byte) (*Delivery, error) {
+	var notification rawNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, err
+	}
+
+	d := &Delivery{
+		Headers:         h,
+		Event:           notification.Event,
+		ctx:             ctx,
+		rawSubscription: notification.Subscription,
+	}
+	if err := json.Unmarshal(notification.Subscription, &d.Subscription); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Context returns the context of the request or connection the delivery was
+// received on, which is done once the delivery no longer needs a response.
+// A Dispatcher may use it to stop waiting to dispatch the delivery.
+func (d *Delivery) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+// Version returns the subscription version of the delivery, taken from the
+// headers or else the subscription. If neither is set, "1" is returned.
+func (d *Delivery) Version() string {
+	if d.Headers.SubscriptionVersion != "" {
+		return d.Headers.SubscriptionVersion
+	} else if d.Subscription.Version != "" {
+		return d.Subscription.Version
+	}
+	return "1"
+}
+
+// HandlerFunc handles a notification with an event decoded into T.
+type HandlerFunc[T any] func(ctx context.Context, d *Delivery, event *T) error
+
+// boundHandler is a handler with its event already decoded.
+type boundHandler func(ctx context.Context, d *Delivery) error
+
+// eventDecoder decodes the event of a delivery and returns a handler bound to
+// the decoded event. The returned handler may be nil if there is nothing to
+// invoke.
+type eventDecoder func(d *Delivery) (boundHandler, error)
+
+type registryKey struct {
+	subscriptionType string
+	version          string
+}
+
+// Registry holds notification handlers keyed by subscription type and
+// version.
+//
+// Handlers are registered with On. A Registry is safe for concurrent use, so
+// handlers may be registered while notifications are being dispatched.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[registryKey][]eventDecoder
+}
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[registryKey][]eventDecoder),
+	}
+}
+
+// On registers a handler for notifications of the given subscription type and
+// version. The event of each notification is decoded into a new T before fn
+// is invoked.
+//
+// Multiple handlers may be registered for the same subscription type and
+// version, in which case each is invoked.
+func On[T any](r *Registry, subscriptionType, version string, fn HandlerFunc[T]) {
+	decoder := func(d *Delivery) (boundHandler, error) {
+		var data T
+		if err := json.Unmarshal(d.Event, &data); err != nil {
+			return nil, errInvalidEvent
+		}
+		return func(ctx context.Context, d *Delivery) error {
+			return fn(ctx, d, &data)
+		}, nil
+	}
+
+	key := registryKey{subscriptionType, version}
+	r.mu.Lock()
+	r.handlers[key] = append(r.handlers[key], decoder)
+	r.mu.Unlock()
+}
+
+// decoders returns the decoders registered for the subscription type and
+// version.
+func (r *Registry) decoders(subscriptionType, version string) []eventDecoder {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[registryKey{subscriptionType, version}]
+}
+
+// fieldDecoder adapts a HandleXXX field of SubHandler into an eventDecoder.
+// The event is decoded even if fn is nil so that invalid payloads are still
+// rejected.
+func fieldDecoder[T any](fn func(h *esb.ResponseHeaders, event *T)) eventDecoder {
+	return func(d *Delivery) (boundHandler, error) {
+		var data T
+		if err := json.Unmarshal(d.Event, &data); err != nil {
+			return nil, errInvalidEvent
+		}
+		if fn == nil {
+			return nil, nil
+		}
+		return func(_ context.Context, d *Delivery) error {
+			fn(d.Headers, &data)
+			return nil
+		}, nil
+	}
+}
+
+// dispatchEvent decodes the event of a delivery for each HandleXXX field and
+// registered handler matching its subscription type and version, then invokes
+// each handler in a new goroutine, or in order in a single task of the
+// Dispatcher. The returned dispatchResult may be used to
+// wait for the handlers, which are given a context that expires after timeout
+// if it is non-zero. ErrShutdown is returned if the SubHandler has been shut
+// down.
+//
+// If there are no handlers for the delivery, OnUnknownNotification is invoked
+// instead. An error is returned for unknown subscription types and versions
+// unless AckUnknownNotifications is set, in which case OnUnknownNotification
+// is not invoked since the notification will be delivered again.
+func (s *SubHandler) dispatchEvent(d *Delivery, timeout time.Duration) (*dispatchResult, error) {
+	subscriptionType, version := d.Headers.SubscriptionType, d.Version()
+
+	var decoders []eventDecoder
+	if field, ok := fieldHandlers[registryKey{subscriptionType, version}]; ok {
+		decoders = append(decoders, field(s))
+	}
+	decoders = append(decoders, s.Registry.decoders(subscriptionType, version)...)
+
+	if len(decoders) == 0 {
+		if s.AckUnknownNotifications {
+			s.dispatchUnknown(d)
+			return nil, nil
+		} else if fieldTypes[subscriptionType] {
+			return nil, &UnsupportedVersionError{
+				SubscriptionType: subscriptionType,
+				Version:          version,
+			}
+		}
+		return nil, errUnknownNotificationType
+	}
+
+	// Decode every event before invoking any handler so that an invalid
+	// payload is rejected as a whole.
+	handlers := make([]boundHandler, 0, len(decoders))
+	for _, decoder := range decoders {
+		handler, err := decoder(d)
+		if err != nil {
+			return nil, err
+		} else if handler != nil {
+			handlers = append(handlers, handler)
+		}
+	}
+
+	if len(handlers) == 0 {
+		s.dispatchUnknown(d)
+		return nil, nil
+	}
+
+	ctx, err := s.startDispatch(len(handlers))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dispatchResult{
+		ctx:     ctx,
+		cancel:  func() {},
+		results: make(chan error, len(handlers)),
+		n:       len(handlers),
+	}
+	result.running.Add(len(handlers))
+	if timeout > 0 {
+		result.ctx, result.cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	if s.Dispatcher == nil {
+		for _, handler := range handlers {
+			go func(handler boundHandler) {
+				defer s.finishDispatch()
+				defer result.running.Done()
+				result.results <- s.runHandler(result.ctx, handler, d)
+			}(handler)
+		}
+		return result, nil
+	}
+
+	// Handlers are dispatched as a single task so that a delivery is never
+	// partially accepted.
+	err = s.Dispatcher.Dispatch(d, func() {
+		for _, handler := range handlers {
+			result.results <- s.runHandler(result.ctx, handler, d)
+			result.running.Done()
+			s.finishDispatch()
+		}
+	})
+	if err != nil {
+		result.cancel()
+		for range handlers {
+			s.finishDispatch()
+		}
+		if errors.Is(err, ErrTaskDropped) {
+			return nil, nil
+		}
+		return nil, &dispatchError{err}
+	}
+	return result, nil
+}
+
+// dispatchUnknown invokes OnUnknownNotification in a new goroutine.
+func (s *SubHandler) dispatchUnknown(d *Delivery) {
+	if s.OnUnknownNotification != nil {
+		_ = s.goCallback(d.Headers, func(_ context.Context) {
+			s.OnUnknownNotification(d.Headers, d.rawSubscription, d.Event)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package eventsub_framework
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOn(t *testing.T) {
+	d := newDispatcher(3)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		d.Trigger()
+	}
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, dl *Delivery, event *esb.EventChannelUpdate) error {
+		assert.Equal(t, "hello there!", event.Title)
+		assert.Equal(t, "ef7e8fba-6c32-4ead-965d-61f21660d095", dl.Subscription.ID)
+		d.Trigger()
+		return nil
+	})
+
+	// Handlers may decode into any type
+	type partialUpdate struct {
+		Title string `json:"title"`
+	}
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, dl *Delivery, event *partialUpdate) error {
+		assert.Equal(t, "hello there!", event.Title)
+		d.Trigger()
+		return nil
+	})
+
+	// Handlers for other versions are not invoked
+	On(handler.Registry, "channel.update", "2", func(ctx context.Context, dl *Delivery, event *esb.EventChannelUpdate) error {
+		t.Error("handler for version 2 invoked")
+		return nil
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+
+	assert.True(t, isOK(res.StatusCode))
+	for i := 0; i < 3; i++ {
+		assert.True(t, d.WaitForTrigger(100*time.Millisecond), "handler failed to trigger")
+	}
+}
+
+func TestOn_NewType(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+
+	type betaEvent struct {
+		BroadcasterUserID string `json:"broadcaster_user_id"`
+	}
+	On(handler.Registry, "channel.beta", "beta", func(ctx context.Context, dl *Delivery, event *betaEvent) error {
+		assert.Equal(t, "132532813", event.BroadcasterUserID)
+		d.Trigger()
+		return nil
+	})
+
+	res := handleRequest(handler, func() *http.Request {
+		req := newNotificationRequest()
+		req.Header.Set("Twitch-Eventsub-Subscription-Type", "channel.beta")
+		req.Header.Set("Twitch-Eventsub-Subscription-Version", "beta")
+		return req
+	})
+
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "handler failed to trigger")
+}
+
+func TestOn_HandlerError(t *testing.T) {
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.OnHandlerError = func(h *esb.ResponseHeaders, err error) {
+		assert.EqualError(t, err, "database unavailable")
+		d.Trigger()
+	}
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, dl *Delivery, event *esb.EventChannelUpdate) error {
+		return errors.New("database unavailable")
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, d.WaitForTrigger(100*time.Millisecond), "OnHandlerError failed to trigger")
+}
+
+func TestOn_InvalidEvent(t *testing.T) {
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, dl *Delivery, event *struct {
+		Title int `json:"title"`
+	}) error {
+		t.Error("handler invoked with invalid event")
+		return nil
+	})
+
+	res := handleRequest(handler, newNotificationRequest)
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,243 @@
+package eventsub_framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// ShardTransportFunc returns the transport that a disabled shard should be
+// moved to.
+type ShardTransportFunc func(ctx context.Context, shardID string) (*ShardTransport, error)
+
+// WebhookShardTransport returns a ShardTransportFunc which moves shards to
+// the given webhook callback.
+func WebhookShardTransport(callback, secret string) ShardTransportFunc {
+	return func(_ context.Context, _ string) (*ShardTransport, error) {
+		return &ShardTransport{
+			Method:   TransportWebhook,
+			Callback: callback,
+			Secret:   secret,
+		}, nil
+	}
+}
+
+// WebSocketShardTransport returns a ShardTransportFunc which moves each shard
+// to the current session of its WSClient, keyed by shard ID. Each shard needs
+// its own WSClient, since a session can only be assigned to one shard.
+func WebSocketShardTransport(clients map[string]*WSClient) ShardTransportFunc {
+	return func(_ context.Context, shardID string) (*ShardTransport, error) {
+		client, ok := clients[shardID]
+		if !ok {
+			return nil, fmt.Errorf("no websocket client for shard %s", shardID)
+		}
+		sessionID := client.SessionID()
+		if sessionID == "" {
+			return nil, fmt.Errorf("websocket client for shard %s has no session", shardID)
+		}
+		return &ShardTransport{
+			Method:    TransportWebSocket,
+			SessionID: sessionID,
+		}, nil
+	}
+}
+
+// ShardRepairError describes why a single shard could not be repaired.
+type ShardRepairError struct {
+	// The ID of the shard that could not be repaired.
+	ID  string
+	Err error
+}
+
+func (e *ShardRepairError) Error() string {
+	return fmt.Sprintf("shard %s: %v", e.ID, e.Err)
+}
+
+func (e *ShardRepairError) Unwrap() error {
+	return e.Err
+}
+
+// ShardRepairErrors is returned by Repair when some shards could not be
+// repaired.
+type ShardRepairErrors []ShardRepairError
+
+func (e ShardRepairErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return "repair conduit shards: " + strings.Join(messages, "; ")
+}
+
+// DefaultShardRepairTimeout is the default time allowed to repair a shard
+// after a conduit.shard.disabled notification.
+const DefaultShardRepairTimeout = 30 * time.Second
+
+// ShardSupervisor repairs disabled shards of a conduit by moving them to a
+// healthy transport.
+//
+// Set the HandleConduitShardDisabled field of a SubHandler to the
+// supervisor's HandleShardDisabled method to repair shards as soon as they
+// are disabled, and call Repair periodically to catch missed events.
+type ShardSupervisor struct {
+	client    *SubClient
+	conduitID string
+	transport ShardTransportFunc
+
+	// Time allowed to repair a shard from HandleShardDisabled. A zero value
+	// allows unlimited time.
+	RepairTimeout time.Duration
+	// Called when the status of a shard changes, or with a non-nil error when
+	// a shard could not be repaired.
+	OnShardStatus func(shardID string, status Status, err error)
+
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+// NewShardSupervisor creates a new ShardSupervisor which moves disabled shards
+// of the given conduit to the transport returned by transport.
+func NewShardSupervisor(
+	client *SubClient,
+	conduitID string,
+	transport ShardTransportFunc,
+) *ShardSupervisor {
+	return &ShardSupervisor{
+		client:        client,
+		conduitID:     conduitID,
+		transport:     transport,
+		RepairTimeout: DefaultShardRepairTimeout,
+		statuses:      make(map[string]Status),
+	}
+}
+
+// HandleShardDisabled handles a conduit.shard.disabled notification by
+// repairing the disabled shard within RepairTimeout. Events for other
+// conduits are ignored.
+func (s *ShardSupervisor) HandleShardDisabled(_ *esb.ResponseHeaders, event *EventConduitShardDisabled) {
+	if event.ConduitID != s.conduitID {
+		return
+	}
+
+	s.setStatus(event.ShardID, event.Status)
+
+	ctx, cancel := context.Background(), func() {}
+	if s.RepairTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.RepairTimeout)
+	}
+	defer cancel()
+	_ = s.RepairShard(ctx, event.ShardID)
+}
+
+// Repair repairs all shards of the conduit that are not enabled or pending
+// verification. Shards which cannot be moved to a transport do not stop the
+// others from being repaired, and are returned in a ShardRepairErrors error
+// along with any shards which failed to update.
+func (s *ShardSupervisor) Repair(ctx context.Context) error {
+	shards, err := s.client.GetConduitShards(ctx, s.conduitID, StatusAny)
+	if err != nil {
+		return err
+	}
+
+	var updates []ShardUpdate
+	var repairErrors ShardRepairErrors
+	for _, shard := range shards {
+		s.setStatus(shard.ID, shard.Status)
+		if isHealthyShardStatus(shard.Status) {
+			continue
+		}
+
+		update, err := s.shardUpdate(ctx, shard.ID)
+		if err != nil {
+			repairErrors = append(repairErrors, ShardRepairError{ID: shard.ID, Err: err})
+			continue
+		}
+		updates = append(updates, *update)
+	}
+
+	if len(updates) > 0 {
+		err := s.update(ctx, updates)
+		var shardErrors ShardUpdateErrors
+		if errors.As(err, &shardErrors) {
+			for i := range shardErrors {
+				repairErrors = append(repairErrors, ShardRepairError{ID: shardErrors[i].ID, Err: &shardErrors[i]})
+			}
+		} else if err != nil {
+			for _, update := range updates {
+				repairErrors = append(repairErrors, ShardRepairError{ID: update.ID, Err: err})
+			}
+		}
+	}
+
+	if len(repairErrors) > 0 {
+		return repairErrors
+	}
+	return nil
+}
+
+// RepairShard moves a single shard of the conduit to a healthy transport.
+func (s *ShardSupervisor) RepairShard(ctx context.Context, shardID string) error {
+	update, err := s.shardUpdate(ctx, shardID)
+	if err != nil {
+		return err
+	}
+	return s.update(ctx, []ShardUpdate{*update})
+}
+
+func (s *ShardSupervisor) shardUpdate(ctx context.Context, shardID string) (*ShardUpdate, error) {
+	transport, err := s.transport(ctx, shardID)
+	if err != nil {
+		s.report(shardID, "", err)
+		return nil, err
+	}
+	return &ShardUpdate{
+		ID:        shardID,
+		Transport: *transport,
+	}, nil
+}
+
+func (s *ShardSupervisor) update(ctx context.Context, updates []ShardUpdate) error {
+	shards, err := s.client.UpdateConduitShards(ctx, s.conduitID, updates)
+	for _, shard := range shards {
+		s.setStatus(shard.ID, shard.Status)
+	}
+
+	var shardErrors ShardUpdateErrors
+	if errors.As(err, &shardErrors) {
+		for i := range shardErrors {
+			s.report(shardErrors[i].ID, "", &shardErrors[i])
+		}
+	} else if err != nil {
+		for _, update := range updates {
+			s.report(update.ID, "", err)
+		}
+	}
+	return err
+}
+
+// setStatus records the status of a shard, reporting it if it changed.
+func (s *ShardSupervisor) setStatus(shardID string, status Status) {
+	s.mu.Lock()
+	changed := s.statuses[shardID] != status
+	s.statuses[shardID] = status
+	s.mu.Unlock()
+
+	if changed {
+		s.report(shardID, status, nil)
+	}
+}
+
+func (s *ShardSupervisor) report(shardID string, status Status, err error) {
+	if s.OnShardStatus != nil {
+		s.OnShardStatus(shardID, status, err)
+	}
+}
+
+func isHealthyShardStatus(status Status) bool {
+	return status == StatusEnabled || status == StatusVerificationPending
+}
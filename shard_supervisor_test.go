@@ -0,0 +1,198 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type shardStatusChange struct {
+	ShardID string
+	Status  Status
+	Err     error
+}
+
+func TestShardSupervisor_Repair(t *testing.T) {
+	var updateBody conduitShardsRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			if req.Method == "GET" {
+				return newTestResponse(http.StatusOK, `{"data":[{"id":"0","status":"enabled","transport":{"method":"webhook","callback":"https://this-is-a-callback.com"}},{"id":"1","status":"websocket_disconnected","transport":{"method":"websocket","session_id":"9fd5164a-a958-4c60-b7f4-6a7202506ca0"}}]}`)
+			}
+			_ = json.NewDecoder(req.Body).Decode(&updateBody)
+			return newTestResponse(http.StatusAccepted, `{"data":[{"id":"1","status":"webhook_callback_verification_pending","transport":{"method":"webhook","callback":"https://this-is-a-callback.com"}}],"errors":[]}`)
+		}),
+	)
+
+	var mu sync.Mutex
+	var changes []shardStatusChange
+	supervisor := NewShardSupervisor(client, "bfcfc993-26b1-b876-44d9-afe75a379dac", WebhookShardTransport("https://this-is-a-callback.com", "s3cRe7"))
+	supervisor.OnShardStatus = func(shardID string, status Status, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, shardStatusChange{shardID, status, err})
+	}
+
+	assert.NoError(t, supervisor.Repair(context.Background()))
+
+	assert.Equal(t, "bfcfc993-26b1-b876-44d9-afe75a379dac", updateBody.ConduitID)
+	assert.Equal(t, []ShardUpdate{{
+		ID:        "1",
+		Transport: ShardTransport{Method: TransportWebhook, Callback: "https://this-is-a-callback.com", Secret: "s3cRe7"},
+	}}, updateBody.Shards)
+	assert.Equal(t, []shardStatusChange{
+		{"0", StatusEnabled, nil},
+		{"1", StatusWebSocketDisconnected, nil},
+		{"1", StatusVerificationPending, nil},
+	}, changes)
+}
+
+func TestShardSupervisor_RepairPartialFailure(t *testing.T) {
+	var updateBody conduitShardsRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			if req.Method == "GET" {
+				return newTestResponse(http.StatusOK, `{"data":[{"id":"0","status":"websocket_disconnected","transport":{"method":"websocket","session_id":"9fd5164a-a958-4c60-b7f4-6a7202506ca0"}},{"id":"1","status":"websocket_disconnected","transport":{"method":"websocket","session_id":"0a4f2c3e-1d7b-4e7a-9b6f-3c2d1e0f9a8b"}}]}`)
+			}
+			_ = json.NewDecoder(req.Body).Decode(&updateBody)
+			return newTestResponse(http.StatusAccepted, `{"data":[{"id":"1","status":"webhook_callback_verification_pending","transport":{"method":"webhook","callback":"https://this-is-a-callback.com"}}],"errors":[]}`)
+		}),
+	)
+
+	transportErr := errors.New("no session for shard")
+	webhook := WebhookShardTransport("https://this-is-a-callback.com", "s3cRe7")
+	supervisor := NewShardSupervisor(client, "bfcfc993-26b1-b876-44d9-afe75a379dac", func(ctx context.Context, shardID string) (*ShardTransport, error) {
+		if shardID == "0" {
+			return nil, transportErr
+		}
+		return webhook(ctx, shardID)
+	})
+
+	var mu sync.Mutex
+	var failed []string
+	supervisor.OnShardStatus = func(shardID string, status Status, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed = append(failed, shardID)
+		}
+	}
+
+	err := supervisor.Repair(context.Background())
+	var repairErrors ShardRepairErrors
+	if assert.ErrorAs(t, err, &repairErrors) {
+		assert.Len(t, repairErrors, 1)
+		assert.Equal(t, "0", repairErrors[0].ID)
+		assert.ErrorIs(t, &repairErrors[0], transportErr)
+	}
+
+	// The other shard was still repaired
+	assert.Equal(t, []ShardUpdate{{
+		ID:        "1",
+		Transport: ShardTransport{Method: TransportWebhook, Callback: "https://this-is-a-callback.com", Secret: "s3cRe7"},
+	}}, updateBody.Shards)
+	assert.Equal(t, []string{"0"}, failed)
+}
+
+func TestShardSupervisor_HandleShardDisabled(t *testing.T) {
+	var updateBody conduitShardsRequest
+	client := NewSubClientHTTP(
+		NewStaticCredentials("client-id", "app-token"),
+		newTestHTTPClient(func(req *http.Request) *http.Response {
+			_ = json.NewDecoder(req.Body).Decode(&updateBody)
+			return newTestResponse(http.StatusAccepted, `{"data":[],"errors":[{"id":"4","message":"The websocket session is not connected","code":""}]}`)
+		}),
+	)
+
+	wsClient := NewWSClient(NewSubHandler(false, nil))
+	wsClient.session = &WSSession{ID: "AQoQILE98gtqShGmLD7AM6yJThAB"}
+
+	var changes []shardStatusChange
+	supervisor := NewShardSupervisor(client, "bfcfc993-26b1-b876-44d9-afe75a379dac", WebSocketShardTransport(map[string]*WSClient{"4": wsClient}))
+	supervisor.OnShardStatus = func(shardID string, status Status, err error) {
+		changes = append(changes, shardStatusChange{shardID, status, err})
+	}
+
+	supervisor.HandleShardDisabled(nil, &EventConduitShardDisabled{
+		ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+		ShardID:   "4",
+		Status:    StatusWebSocketDisconnected,
+	})
+
+	assert.Equal(t, "AQoQILE98gtqShGmLD7AM6yJThAB", updateBody.Shards[0].Transport.SessionID)
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, shardStatusChange{"4", StatusWebSocketDisconnected, nil}, changes[0])
+		assert.Equal(t, "4", changes[1].ShardID)
+		assert.Error(t, changes[1].Err)
+	}
+}
+
+func TestWebSocketShardTransport(t *testing.T) {
+	clients := make(map[string]*WSClient)
+	for _, shardID := range []string{"0", "1"} {
+		clients[shardID] = NewWSClient(NewSubHandler(false, nil))
+		clients[shardID].session = &WSSession{ID: "session-" + shardID}
+	}
+	transport := WebSocketShardTransport(clients)
+
+	// Each shard is moved to the session of its own client
+	for _, shardID := range []string{"0", "1"} {
+		st, err := transport(context.Background(), shardID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, ShardTransport{Method: TransportWebSocket, SessionID: "session-" + shardID}, *st)
+		}
+	}
+
+	_, err := transport(context.Background(), "2")
+	assert.EqualError(t, err, "no websocket client for shard 2")
+
+	clients["1"].session = nil
+	_, err = transport(context.Background(), "1")
+	assert.EqualError(t, err, "websocket client for shard 1 has no session")
+}
+
+func TestShardSupervisor_HandleShardDisabledTimeout(t *testing.T) {
+	// Never responds until the test ends
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client := NewSubClientURL(NewStaticCredentials("client-id", "app-token"), http.DefaultClient, server.URL)
+
+	var changes []shardStatusChange
+	supervisor := NewShardSupervisor(client, "bfcfc993-26b1-b876-44d9-afe75a379dac", WebhookShardTransport("https://this-is-a-callback.com", "s3cRe7"))
+	supervisor.RepairTimeout = 50 * time.Millisecond
+	supervisor.OnShardStatus = func(shardID string, status Status, err error) {
+		changes = append(changes, shardStatusChange{shardID, status, err})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		supervisor.HandleShardDisabled(nil, &EventConduitShardDisabled{
+			ConduitID: "bfcfc993-26b1-b876-44d9-afe75a379dac",
+			ShardID:   "0",
+			Status:    StatusVerificationFailed,
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleShardDisabled did not return after RepairTimeout")
+	}
+	if assert.Len(t, changes, 2) {
+		assert.ErrorIs(t, changes[1].Err, context.DeadlineExceeded)
+	}
+}
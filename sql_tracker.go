@@ -0,0 +1,265 @@
+package eventsub_framework
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultSQLTrackerTable is the name of the table used by a SQLTracker if none
+// is given.
+const DefaultSQLTrackerTable = "eventsub_message_ids"
+
+// SQLDialect provides the statements a SQLTracker runs for a database.
+type SQLDialect interface {
+	// Schema returns the statements which create the table if it does not
+	// exist. The table has an id primary key, an expires_at integer column
+	// holding a Unix time, and a reserved boolean column.
+	Schema(table string) []string
+	// InsertIfAbsent returns a statement which takes an ID, its expiry,
+	// whether it is reserved and the current time, and inserts the ID unless
+	// it is present and has not expired. The statement must affect no rows if
+	// the ID is present.
+	InsertIfAbsent(table string) string
+	// Placeholder returns the placeholder for the nth parameter of a
+	// statement, starting from 1.
+	Placeholder(n int) string
+}
+
+var (
+	// PostgresDialect is the SQLDialect for PostgreSQL.
+	PostgresDialect SQLDialect = postgresDialect{}
+	// MySQLDialect is the SQLDialect for MySQL and MariaDB.
+	MySQLDialect SQLDialect = mysqlDialect{}
+	// SQLiteDialect is the SQLDialect for SQLite 3.24.0 and later.
+	SQLiteDialect SQLDialect = sqliteDialect{}
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Schema(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(255) PRIMARY KEY, expires_at BIGINT NOT NULL, reserved BOOLEAN NOT NULL DEFAULT FALSE)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", table, table),
+	}
+}
+
+func (postgresDialect) InsertIfAbsent(table string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (id, expires_at, reserved) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (id) DO UPDATE SET expires_at = EXCLUDED.expires_at, reserved = EXCLUDED.reserved "+
+			"WHERE %s.expires_at <= $4",
+		table, table,
+	)
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Schema(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(255) PRIMARY KEY, expires_at BIGINT NOT NULL, reserved BOOLEAN NOT NULL DEFAULT FALSE, INDEX (expires_at))", table),
+	}
+}
+
+// InsertIfAbsent relies on MySQL reporting no affected rows when an update
+// leaves a row unchanged, which is the default unless the client sets
+// CLIENT_FOUND_ROWS. The values are selected from a derived table so that the
+// current time is only passed once, and reserved is assigned before expires_at
+// so that both compare the old expiry.
+func (mysqlDialect) InsertIfAbsent(table string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (id, expires_at, reserved) "+
+			"SELECT v.id, v.expires_at, v.reserved FROM (SELECT ? AS id, ? AS expires_at, ? AS reserved, ? AS now) AS v "+
+			"ON DUPLICATE KEY UPDATE "+
+			"reserved = IF(%s.expires_at <= v.now, v.reserved, %s.reserved), "+
+			"expires_at = IF(%s.expires_at <= v.now, v.expires_at, %s.expires_at)",
+		table, table, table, table, table,
+	)
+}
+
+func (mysqlDialect) Placeholder(int) string {
+	return "?"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Schema(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, expires_at INTEGER NOT NULL, reserved BOOLEAN NOT NULL DEFAULT FALSE)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", table, table),
+	}
+}
+
+func (sqliteDialect) InsertIfAbsent(table string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (id, expires_at, reserved) VALUES (?, ?, ?) "+
+			"ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, reserved = excluded.reserved "+
+			"WHERE %s.expires_at <= ?",
+		table, table,
+	)
+}
+
+func (sqliteDialect) Placeholder(int) string {
+	return "?"
+}
+
+// SQLTracker is a ReservingIDTracker which stores IDs in a database, so that
+// duplicates are detected across every process sharing the database. IDs
+// expire after the TTL.
+//
+// Expired IDs are not removed from the table automatically. Call Cleanup
+// periodically, or run RunCleanup in a goroutine.
+type SQLTracker struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	// How long a reservation is held before it expires.
+	ReservationTTL time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	schema        []string
+	insertQuery   string
+	reservedQuery string
+	commitQuery   string
+	releaseQuery  string
+	removeQuery   string
+	cleanupQuery  string
+}
+
+// NewSQLTracker creates a new SQLTracker which stores IDs in the given table
+// of db. The table name is used in statements as is. If table is empty,
+// DefaultSQLTrackerTable is used.
+func NewSQLTracker(db *sql.DB, dialect SQLDialect, table string, ttl time.Duration) *SQLTracker {
+	if table == "" {
+		table = DefaultSQLTrackerTable
+	}
+
+	p := dialect.Placeholder
+	return &SQLTracker{
+		db:             db,
+		ttl:            ttl,
+		ReservationTTL: DefaultReservationTTL,
+		schema:         dialect.Schema(table),
+		insertQuery:    dialect.InsertIfAbsent(table),
+		reservedQuery:  fmt.Sprintf("SELECT reserved FROM %s WHERE id = %s AND expires_at > %s", table, p(1), p(2)),
+		commitQuery:    fmt.Sprintf("UPDATE %s SET expires_at = %s, reserved = %s WHERE id = %s", table, p(1), p(2), p(3)),
+		releaseQuery:   fmt.Sprintf("DELETE FROM %s WHERE id = %s AND reserved = %s", table, p(1), p(2)),
+		removeQuery:    fmt.Sprintf("DELETE FROM %s WHERE id = %s", table, p(1)),
+		cleanupQuery:   fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", table, p(1)),
+	}
+}
+
+func (t *SQLTracker) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+// CreateSchema creates the table if it does not exist.
+func (t *SQLTracker) CreateSchema(ctx context.Context) error {
+	for _, statement := range t.schema {
+		if _, err := t.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *SQLTracker) AddAndCheckIfDuplicate(ctx context.Context, id string) (bool, error) {
+	inserted, err := t.insert(ctx, id, t.now(), t.ttl, false)
+	return !inserted, err
+}
+
+func (t *SQLTracker) Reserve(ctx context.Context, id string) (bool, error) {
+	now := t.now()
+	if inserted, err := t.insert(ctx, id, now, t.ReservationTTL, true); err != nil || inserted {
+		return inserted, err
+	}
+
+	var reserved bool
+	err := t.db.QueryRowContext(ctx, t.reservedQuery, id, now.Unix()).Scan(&reserved)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The reservation ended since it was inserted
+		return false, ErrIDReserved
+	} else if err != nil {
+		return false, err
+	} else if reserved {
+		return false, ErrIDReserved
+	}
+	return false, nil
+}
+
+func (t *SQLTracker) Commit(ctx context.Context, id string) error {
+	now := t.now()
+	res, err := t.db.ExecContext(ctx, t.commitQuery, now.Add(t.ttl).Unix(), false, id)
+	if err != nil {
+		return err
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+	// The reservation was cleaned up after it expired
+	_, err = t.insert(ctx, id, now, t.ttl, false)
+	return err
+}
+
+func (t *SQLTracker) Release(ctx context.Context, id string) error {
+	_, err := t.db.ExecContext(ctx, t.releaseQuery, id, true)
+	return err
+}
+
+// insert inserts the ID unless it is present and has not expired, returning
+// whether it was inserted.
+func (t *SQLTracker) insert(ctx context.Context, id string, now time.Time, ttl time.Duration, reserved bool) (bool, error) {
+	res, err := t.db.ExecContext(ctx, t.insertQuery, id, now.Add(ttl).Unix(), reserved, now.Unix())
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted > 0, nil
+}
+
+func (t *SQLTracker) Remove(ctx context.Context, id string) error {
+	_, err := t.db.ExecContext(ctx, t.removeQuery, id)
+	return err
+}
+
+// Cleanup deletes expired IDs and returns how many were deleted.
+func (t *SQLTracker) Cleanup(ctx context.Context) (int64, error) {
+	res, err := t.db.ExecContext(ctx, t.cleanupQuery, t.now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunCleanup calls Cleanup at the given interval until the context is done,
+// then returns the context's error. Errors from Cleanup are passed to onError
+// if it is non-nil.
+func (t *SQLTracker) RunCleanup(ctx context.Context, interval time.Duration, onError func(err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := t.Cleanup(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package eventsub_framework
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLTracker(t *testing.T, ttl time.Duration) *SQLTracker {
+	if !hasSQLDriver("sqlite3") {
+		t.Skip("SQLite driver requires cgo")
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "ids.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite allows a single writer
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	tracker := NewSQLTracker(db, SQLiteDialect, "", ttl)
+	if err := tracker.CreateSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Creating the schema again is a no-op
+	if err := tracker.CreateSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return tracker
+}
+
+func hasSQLDriver(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSQLTracker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker := newTestSQLTracker(t, 10*time.Minute)
+	tracker.Clock = func() time.Time { return now }
+
+	duplicate, err := tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	assert.NoError(t, tracker.Remove(ctx, "a"))
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+
+	// An expired ID is inserted again even before it is cleaned up
+	now = now.Add(10 * time.Minute)
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.False(t, duplicate)
+	duplicate, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	assert.True(t, duplicate)
+}
+
+func TestSQLTracker_Reserve(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker := newTestSQLTracker(t, 10*time.Minute)
+	tracker.Clock = func() time.Time { return now }
+
+	reserved, err := tracker.Reserve(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.ErrorIs(t, err, ErrIDReserved)
+
+	assert.NoError(t, tracker.Release(ctx, "a"))
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.True(t, reserved)
+
+	assert.NoError(t, tracker.Commit(ctx, "a"))
+	assert.NoError(t, tracker.Release(ctx, "a")) // committed IDs are not released
+	reserved, err = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+	assert.NoError(t, err)
+
+	// Reservations expire before committed IDs
+	reserved, _ = tracker.Reserve(ctx, "b")
+	assert.True(t, reserved)
+	now = now.Add(DefaultReservationTTL)
+	reserved, _ = tracker.Reserve(ctx, "b")
+	assert.True(t, reserved)
+	reserved, _ = tracker.Reserve(ctx, "a")
+	assert.False(t, reserved)
+
+	// A reservation which was cleaned up can still be committed
+	now = now.Add(DefaultReservationTTL)
+	_, _ = tracker.Cleanup(ctx)
+	assert.NoError(t, tracker.Commit(ctx, "b"))
+	reserved, err = tracker.Reserve(ctx, "b")
+	assert.False(t, reserved)
+	assert.NoError(t, err)
+}
+
+func TestSQLTracker_Cleanup(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 9, 4, 46, 0, 0, time.UTC)
+
+	tracker := newTestSQLTracker(t, 10*time.Minute)
+	tracker.Clock = func() time.Time { return now }
+
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "a")
+	now = now.Add(5 * time.Minute)
+	_, _ = tracker.AddAndCheckIfDuplicate(ctx, "b")
+	now = now.Add(5 * time.Minute)
+
+	deleted, err := tracker.Cleanup(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	duplicate, _ := tracker.AddAndCheckIfDuplicate(ctx, "b")
+	assert.True(t, duplicate)
+}
+
+func TestSQLTracker_Concurrent(t *testing.T) {
+	testTrackerConcurrency(t, newTestSQLTracker(t, time.Hour))
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package eventsub_framework
+
+// The SQLite driver requires cgo, so the SQLTracker tests are skipped
+// without it.
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,559 @@
+package eventsub_framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// EventSubWebSocketURL is the default Twitch EventSub WebSocket server.
+	EventSubWebSocketURL = "wss://eventsub.wss.twitch.tv/ws"
+
+	sessionWelcomeMessageType   = "session_welcome"
+	sessionKeepaliveMessageType = "session_keepalive"
+	sessionReconnectMessageType = "session_reconnect"
+)
+
+// WSSession describes an EventSub WebSocket session.
+type WSSession struct {
+	// The ID of the session, used when subscribing with the WebSocket
+	// transport.
+	ID string `json:"id"`
+	// The status of the session.
+	Status string `json:"status"`
+	// RFC3339 timestamp of when the connection was created.
+	ConnectedAt string `json:"connected_at"`
+	// The maximum number of seconds between messages from Twitch before the
+	// connection should be considered dead.
+	KeepaliveTimeoutSeconds int `json:"keepalive_timeout_seconds"`
+	// The URL to reconnect to when a session_reconnect message is received.
+	ReconnectURL string `json:"reconnect_url"`
+}
+
+type wsMessage struct {
+	Metadata wsMetadata      `json:"metadata"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+type wsMetadata struct {
+	MessageID           string `json:"message_id"`
+	MessageType         string `json:"message_type"`
+	MessageTimestamp    string `json:"message_timestamp"`
+	SubscriptionType    string `json:"subscription_type"`
+	SubscriptionVersion string `json:"subscription_version"`
+}
+
+// headers converts the message metadata into the equivalent webhook headers.
+func (m *wsMetadata) headers() *esb.ResponseHeaders {
+	return &esb.ResponseHeaders{
+		MessageID:           m.MessageID,
+		MessageType:         m.MessageType,
+		MessageTimestamp:    m.MessageTimestamp,
+		SubscriptionType:    m.SubscriptionType,
+		SubscriptionVersion: m.SubscriptionVersion,
+	}
+}
+
+type wsSessionPayload struct {
+	Session WSSession `json:"session"`
+}
+
+var (
+	// ErrKeepaliveTimeout is the reason given when no message is received
+	// from the server within the session's keepalive timeout.
+	ErrKeepaliveTimeout = errors.New("websocket keepalive timeout")
+	// ErrSessionReconnect is the reason given when the server requests that
+	// the client reconnects with a session_reconnect message.
+	ErrSessionReconnect = errors.New("session reconnect requested")
+)
+
+const (
+	// DefaultKeepaliveGrace is the default extra time allowed past the
+	// keepalive timeout before a connection is considered dead.
+	DefaultKeepaliveGrace = 5 * time.Second
+	// DefaultMinReconnectDelay is the default initial delay before
+	// reconnecting after a connection is lost.
+	DefaultMinReconnectDelay = time.Second
+	// DefaultMaxReconnectDelay is the default maximum delay before
+	// reconnecting after a connection is lost.
+	DefaultMaxReconnectDelay = 2 * time.Minute
+	// DefaultDrainTimeout is the default time allowed for the server to close
+	// the old connection after following a session_reconnect message.
+	DefaultDrainTimeout = time.Second
+
+	// Keepalive timeout used until a session_welcome message is received.
+	defaultKeepaliveTimeoutSeconds = 10
+)
+
+// WSClient receives Twitch EventSub notifications over the WebSocket
+// transport.
+//
+// Notifications are dispatched to the HandleXXX functions of Handler in the
+// same way as webhook notifications, so one SubHandler can be used for both
+// transports. The IDTracker, OnDuplicateNotification and OnRevocation fields
+// of Handler are also used.
+//
+// If no message is received within the session's keepalive timeout, the
+// connection is considered dead and a new session is created after a delay.
+// session_reconnect messages are followed without creating a new session.
+type WSClient struct {
+	// Handler used to dispatch notifications and revocations.
+	Handler *SubHandler
+	// URL of the EventSub WebSocket server.
+	URL string
+	// Dialer used to connect to the server.
+	Dialer *websocket.Dialer
+
+	// Extra time allowed past the keepalive timeout before the connection is
+	// considered dead.
+	KeepaliveGrace time.Duration
+	// Initial delay before reconnecting after a connection is lost. The delay
+	// doubles with each failed attempt, with jitter applied.
+	MinReconnectDelay time.Duration
+	// Maximum delay before reconnecting after a connection is lost.
+	MaxReconnectDelay time.Duration
+	// How long to keep handling messages from the old connection once the
+	// connection made by following a session_reconnect message is welcomed.
+	// The old connection is closed once the server closes it or this time
+	// passes.
+	DrainTimeout time.Duration
+
+	// Called when a new session is created. Subscriptions using the session
+	// ID must be created from this function, as subscriptions do not carry
+	// over to new sessions.
+	OnWelcome func(session *WSSession)
+	// Called when a connection is established and welcomed, including after
+	// following a session_reconnect message.
+	OnConnected func(session *WSSession)
+	// Called before reconnecting with the reason for reconnecting and the
+	// delay before the attempt.
+	OnReconnecting func(reason error, delay time.Duration)
+	// Called when a connection is lost with the reason it was lost.
+	OnDisconnected func(reason error)
+	// Called when a message could not be processed.
+	OnError func(err error)
+
+	mu      sync.Mutex
+	session *WSSession
+}
+
+// NewWSClient creates a new WSClient which dispatches notifications to the
+// given SubHandler.
+func NewWSClient(handler *SubHandler) *WSClient {
+	return &WSClient{
+		Handler:           handler,
+		URL:               EventSubWebSocketURL,
+		Dialer:            websocket.DefaultDialer,
+		KeepaliveGrace:    DefaultKeepaliveGrace,
+		MinReconnectDelay: DefaultMinReconnectDelay,
+		MaxReconnectDelay: DefaultMaxReconnectDelay,
+		DrainTimeout:      DefaultDrainTimeout,
+	}
+}
+
+// Session returns the current session, or nil if no session_welcome message
+// has been received yet.
+func (c *WSClient) Session() *WSSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// SessionID returns the ID of the current session, or an empty string if no
+// session_welcome message has been received yet.
+func (c *WSClient) SessionID() string {
+	if session := c.Session(); session != nil {
+		return session.ID
+	}
+	return ""
+}
+
+// Run connects to the server and processes messages until the context is
+// cancelled. Lost connections are reconnected with exponential backoff.
+//
+// Run always returns a non-nil error from the context.
+func (c *WSClient) Run(ctx context.Context) error {
+	attempt := 0
+	for {
+		welcomed, err := c.runSession(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if welcomed {
+			attempt = 0
+		}
+		c.setSession(nil)
+		if c.OnDisconnected != nil {
+			c.OnDisconnected(err)
+		}
+
+		delay := c.reconnectDelay(attempt)
+		attempt++
+		if c.OnReconnecting != nil {
+			c.OnReconnecting(err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// reconnectDelay returns the delay before the given reconnect attempt, which
+// is chosen randomly between half and all of the exponential backoff delay.
+func (c *WSClient) reconnectDelay(attempt int) time.Duration {
+	delay, maxDelay := c.MinReconnectDelay, c.MaxReconnectDelay
+	if delay <= 0 {
+		delay = DefaultMinReconnectDelay
+	}
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// runSession creates a new session and processes its messages until the
+// connection is lost, returning whether a session_welcome message was
+// received and the reason the connection was lost.
+func (c *WSClient) runSession(ctx context.Context) (bool, error) {
+	current, err := c.dial(ctx, c.URL)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		current.close()
+	}()
+
+	// Connection created by following a session_reconnect message, which
+	// replaces the current connection once it is welcomed.
+	var next *wsConn
+	defer func() {
+		if next != nil {
+			next.close()
+		}
+	}()
+
+	welcomed := false
+	keepalive := time.NewTimer(c.keepaliveTimeout(nil))
+	defer keepalive.Stop()
+
+	for {
+		var nextMessages <-chan []byte
+		if next != nil {
+			nextMessages = next.messages
+		}
+
+		select {
+		case <-ctx.Done():
+			return welcomed, ctx.Err()
+		case <-keepalive.C:
+			return welcomed, ErrKeepaliveTimeout
+		case data, ok := <-current.messages:
+			if !ok {
+				return welcomed, current.err
+			}
+			resetTimer(keepalive, c.keepaliveTimeout(c.Session()))
+
+			msg, err := decodeWSMessage(data)
+			if err != nil {
+				c.reportError(err)
+				continue
+			}
+
+			switch msg.Metadata.MessageType {
+			case sessionWelcomeMessageType:
+				session, err := decodeWSSession(msg)
+				if err != nil {
+					c.reportError(err)
+					continue
+				}
+				welcomed = true
+				c.welcome(session, current.resumed)
+				resetTimer(keepalive, c.keepaliveTimeout(session))
+			case sessionReconnectMessageType:
+				session, err := decodeWSSession(msg)
+				if err != nil {
+					c.reportError(err)
+					continue
+				} else if session.ReconnectURL == "" {
+					c.reportError(errors.New("session_reconnect message missing reconnect_url"))
+					continue
+				}
+
+				if c.OnReconnecting != nil {
+					c.OnReconnecting(ErrSessionReconnect, 0)
+				}
+				if next != nil {
+					next.close()
+				}
+				// The current connection still works until the server
+				// closes it, so keep using it if the new one fails.
+				next, err = c.dial(ctx, session.ReconnectURL)
+				if err != nil {
+					c.reportError(fmt.Errorf("follow session_reconnect: %w", err))
+					continue
+				}
+				next.resumed = true
+			default:
+				if err := c.handleMessage(ctx, msg); err != nil {
+					c.reportError(err)
+				}
+			}
+		case data, ok := <-nextMessages:
+			if !ok {
+				c.reportError(fmt.Errorf("follow session_reconnect: %w", next.err))
+				next = nil
+				continue
+			}
+
+			msg, err := decodeWSMessage(data)
+			if err != nil {
+				c.reportError(err)
+				continue
+			} else if msg.Metadata.MessageType != sessionWelcomeMessageType {
+				c.reportError(fmt.Errorf("expected %s, got %q", sessionWelcomeMessageType, msg.Metadata.MessageType))
+				continue
+			}
+
+			session, err := decodeWSSession(msg)
+			if err != nil {
+				c.reportError(err)
+				continue
+			}
+
+			// Messages sent on the old connection before the new one was
+			// welcomed may still be arriving, so handle them until the
+			// server closes it, then switch to the new one. Messages on
+			// the new connection wait until then.
+			c.drain(ctx, current)
+			current.close()
+			current, next = next, nil
+			c.welcome(session, true)
+			resetTimer(keepalive, c.keepaliveTimeout(session))
+		}
+	}
+}
+
+// drain handles the notifications and revocations from a connection which is
+// being replaced, until the server closes it or DrainTimeout passes.
+func (c *WSClient) drain(ctx context.Context, wc *wsConn) {
+	timeout := time.NewTimer(c.DrainTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			return
+		case data, ok := <-wc.messages:
+			if !ok {
+				return
+			}
+			msg, err := decodeWSMessage(data)
+			if err != nil {
+				c.reportError(err)
+				continue
+			}
+			switch msg.Metadata.MessageType {
+			case sessionWelcomeMessageType, sessionReconnectMessageType:
+				// The session is already being replaced
+			default:
+				if err := c.handleMessage(ctx, msg); err != nil {
+					c.reportError(err)
+				}
+			}
+		}
+	}
+}
+
+// welcome records a welcomed session and invokes the lifecycle hooks.
+func (c *WSClient) welcome(session *WSSession, resumed bool) {
+	c.setSession(session)
+	if !resumed && c.OnWelcome != nil {
+		go c.OnWelcome(session)
+	}
+	if c.OnConnected != nil {
+		c.OnConnected(session)
+	}
+}
+
+func (c *WSClient) setSession(session *WSSession) {
+	c.mu.Lock()
+	c.session = session
+	c.mu.Unlock()
+}
+
+// keepaliveTimeout returns the maximum time to wait for a message.
+func (c *WSClient) keepaliveTimeout(session *WSSession) time.Duration {
+	seconds := defaultKeepaliveTimeoutSeconds
+	if session != nil && session.KeepaliveTimeoutSeconds > 0 {
+		seconds = session.KeepaliveTimeoutSeconds
+	}
+	return time.Duration(seconds)*time.Second + c.KeepaliveGrace
+}
+
+// isDuplicate returns whether the message has already been handled. Messages
+// sent over WebSocket are not redelivered, so one which is still being
+// handled is treated as a duplicate.
+func (c *WSClient) isDuplicate(ctx context.Context, h *esb.ResponseHeaders) (bool, error) {
+	duplicate, err := c.Handler.isDuplicate(ctx, h)
+	if errors.Is(err, ErrIDReserved) {
+		return true, nil
+	}
+	return duplicate, err
+}
+
+// handleMessage processes a notification or revocation message.
+func (c *WSClient) handleMessage(ctx context.Context, msg *wsMessage) error {
+	h := msg.Metadata.headers()
+
+	switch h.MessageType {
+	case sessionKeepaliveMessageType:
+		// Nothing to do
+	case notificationMessageType:
+		d, err := decodeDelivery(ctx, h, msg.Payload)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", h.MessageType, err)
+		}
+		if duplicate, err := c.isDuplicate(ctx, h); err != nil || duplicate {
+			return err
+		}
+		_, err = c.Handler.dispatchEvent(d, 0)
+		c.Handler.finishID(h, err == nil)
+		if err != nil {
+			return fmt.Errorf("dispatch %s: %w", h.SubscriptionType, err)
+		}
+	case revocationMessageType:
+		var revocation revocationNotification
+		if err := json.Unmarshal(msg.Payload, &revocation); err != nil {
+			return fmt.Errorf("decode %s: %w", h.MessageType, err)
+		}
+		if duplicate, err := c.isDuplicate(ctx, h); err != nil || duplicate {
+			return err
+		}
+		err := c.Handler.dispatchRevocation(h, &revocation.Subscription)
+		c.Handler.finishID(h, err == nil)
+		if err != nil {
+			return fmt.Errorf("dispatch %s: %w", h.MessageType, err)
+		}
+	default:
+		return fmt.Errorf("unknown message type %q", h.MessageType)
+	}
+
+	return nil
+}
+
+func (c *WSClient) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+func decodeWSMessage(data []byte) (*wsMessage, error) {
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	return &msg, nil
+}
+
+func decodeWSSession(msg *wsMessage) (*WSSession, error) {
+	var payload wsSessionPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", msg.Metadata.MessageType, err)
+	}
+	return &payload.Session, nil
+}
+
+// resetTimer stops and drains t before resetting it to d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// wsConn reads messages from a WebSocket connection in a separate goroutine.
+type wsConn struct {
+	conn *websocket.Conn
+	// Receives each message read from the connection. Closed once reading
+	// fails, after which err is set.
+	messages chan []byte
+	err      error
+	// Whether the connection was created by following a session_reconnect
+	// message.
+	resumed bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *WSClient) dial(ctx context.Context, url string) (*wsConn, error) {
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+
+	conn, _, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial websocket: %w", err)
+	}
+
+	wc := &wsConn{
+		conn:     conn,
+		messages: make(chan []byte),
+		done:     make(chan struct{}),
+	}
+	go wc.read()
+	return wc, nil
+}
+
+func (wc *wsConn) read() {
+	defer close(wc.messages)
+	for {
+		_, data, err := wc.conn.ReadMessage()
+		if err != nil {
+			wc.err = fmt.Errorf("read websocket: %w", err)
+			return
+		}
+
+		select {
+		case wc.messages <- data:
+		case <-wc.done:
+			wc.err = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (wc *wsConn) close() {
+	wc.closeOnce.Do(func() {
+		close(wc.done)
+		_ = wc.conn.Close()
+	})
+}
@@ -0,0 +1,313 @@
+package eventsub_framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	wsWelcomeMessage      = `{"metadata":{"message_id":"96a3f3b5-5dec-4eed-908e-e11ee657416c","message_type":"session_welcome","message_timestamp":"2023-07-19T14:56:51.634234626Z"},"payload":{"session":{"id":"AQoQILE98gtqShGmLD7AM6yJThAB","status":"connected","connected_at":"2023-07-19T14:56:51.616329898Z","keepalive_timeout_seconds":10,"reconnect_url":null}}}`
+	wsKeepaliveMessage    = `{"metadata":{"message_id":"84c1e79a-2a4b-4c13-ba0b-4312293e9308","message_type":"session_keepalive","message_timestamp":"2023-07-19T10:11:12.634234626Z"},"payload":{}}`
+	wsNotificationMessage = `{"metadata":{"message_id":"befa7b53-d79d-478f-86b9-120f112b044e","message_type":"notification","message_timestamp":"2022-11-16T10:11:12.464757833Z","subscription_type":"channel.update","subscription_version":"1"},"payload":{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"enabled","type":"channel.update","version":"1","cost":0,"condition":{"broadcaster_user_id":"132532813"},"transport":{"method":"websocket","session_id":"AQoQILE98gtqShGmLD7AM6yJThAB"},"created_at":"2022-11-16T10:11:12.464757833Z"},"event":{"broadcaster_user_id":"132532813","broadcaster_user_login":"icelys","broadcaster_user_name":"icelys","title":"hello there!","language":"en","category_id":"509658","category_name":"Just Chatting","is_mature":false}}}`
+	wsRevocationMessage   = `{"metadata":{"message_id":"84c1e79a-2a4b-4c13-ba0b-4312293e9308","message_type":"revocation","message_timestamp":"2022-11-16T10:11:12.464757833Z","subscription_type":"channel.follow","subscription_version":"1"},"payload":{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","status":"authorization_revoked","type":"channel.follow","version":"1","cost":1,"condition":{"broadcaster_user_id":"12826"},"transport":{"method":"websocket","session_id":"AQoQexAWVYKSTIu4ec_2VAxyuhAB"},"created_at":"2022-11-16T10:11:12.464757833Z"}}}`
+)
+
+func TestWSClient_Run(t *testing.T) {
+	server := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage, wsKeepaliveMessage, wsNotificationMessage, wsRevocationMessage)
+		waitForWSClose(conn)
+	})
+	defer server.Close()
+
+	d := newDispatcher(3)
+	handler := NewSubHandler(false, nil)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		assert.Equal(t, "befa7b53-d79d-478f-86b9-120f112b044e", h.MessageID)
+		assert.Equal(t, "hello there!", event.Title)
+		d.Trigger()
+	}
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason Status) {
+		assert.Equal(t, StatusAuthorizationRevoked, reason)
+		d.Trigger()
+	}
+
+	client := NewWSClient(handler)
+	client.URL = wsURL(server, "/ws")
+	client.OnWelcome = func(session *WSSession) {
+		assert.Equal(t, "AQoQILE98gtqShGmLD7AM6yJThAB", session.ID)
+		assert.Equal(t, 10, session.KeepaliveTimeoutSeconds)
+		d.Trigger()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Run(ctx)
+	}()
+
+	assert.True(t, d.WaitForTrigger(time.Second), "OnWelcome failed to trigger")
+	assert.True(t, d.WaitForTrigger(time.Second), "HandleChannelUpdate failed to trigger")
+	assert.True(t, d.WaitForTrigger(time.Second), "OnRevocation failed to trigger")
+	assert.Equal(t, "AQoQILE98gtqShGmLD7AM6yJThAB", client.SessionID())
+
+	cancel()
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestWSClient_Run_SessionReconnect(t *testing.T) {
+	reconnectServer := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage, wsNotificationMessageWithID("b"))
+		waitForWSClose(conn)
+	})
+	defer reconnectServer.Close()
+
+	// Closed once the client closes the old connection
+	oldClosed := make(chan struct{})
+	firstServer := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage, wsNotificationMessageWithID("a"),
+			wsReconnectMessage(wsURL(reconnectServer, "/ws")))
+		// The server never closes the old connection, so the client must
+		// close it once the new connection is welcomed.
+		waitForWSClose(conn)
+		close(oldClosed)
+	})
+	defer firstServer.Close()
+
+	handled := make(chan string, 2)
+	handler := NewSubHandler(false, nil)
+	handler.IDTracker = NewMapTracker()
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		handled <- h.MessageID
+	}
+
+	var welcomes, connects, disconnects int32
+	client := NewWSClient(handler)
+	client.URL = wsURL(firstServer, "/ws")
+	client.DrainTimeout = 50 * time.Millisecond
+	client.OnWelcome = func(session *WSSession) {
+		atomic.AddInt32(&welcomes, 1)
+	}
+	client.OnConnected = func(session *WSSession) {
+		atomic.AddInt32(&connects, 1)
+	}
+	client.OnDisconnected = func(reason error) {
+		atomic.AddInt32(&disconnects, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = client.Run(ctx)
+	}()
+
+	// Well within the keepalive timeout, so the client cannot be waiting for
+	// the old connection to time out.
+	got := make(map[string]bool)
+	for len(got) < 2 {
+		select {
+		case id := <-handled:
+			got[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("notifications were not handled, got %v", got)
+		}
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, got)
+	select {
+	case <-oldClosed:
+	case <-time.After(time.Second):
+		t.Fatal("old connection was not closed after the new connection was welcomed")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&welcomes))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connects))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&disconnects))
+}
+
+func TestWSClient_Run_SessionReconnectDrain(t *testing.T) {
+	reconnectWelcomed := make(chan struct{})
+	reconnectServer := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage)
+		close(reconnectWelcomed)
+		writeWSMessages(conn, wsNotificationMessageWithID("c"))
+		waitForWSClose(conn)
+	})
+	defer reconnectServer.Close()
+
+	firstServer := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage, wsReconnectMessage(wsURL(reconnectServer, "/ws")))
+		// Notifications sent before the new connection was welcomed can
+		// still arrive on the old connection, until the server closes it.
+		<-reconnectWelcomed
+		time.Sleep(50 * time.Millisecond)
+		writeWSMessages(conn, wsNotificationMessageWithID("a"), wsNotificationMessageWithID("b"))
+	})
+	defer firstServer.Close()
+
+	handled := make(chan string, 3)
+	handler := NewSubHandler(false, nil)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		handled <- h.MessageID
+	}
+
+	client := NewWSClient(handler)
+	client.URL = wsURL(firstServer, "/ws")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = client.Run(ctx)
+	}()
+
+	got := make(map[string]bool)
+	for len(got) < 3 {
+		select {
+		case id := <-handled:
+			got[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("notifications were not handled, got %v", got)
+		}
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "c": true}, got)
+}
+
+func TestWSClient_Run_SessionReconnectDialFailed(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachableURL := wsURL(unreachable, "/ws")
+	unreachable.Close()
+
+	server := newWSTestServer(t, func(conn *websocket.Conn) {
+		writeWSMessages(conn, wsWelcomeMessage, wsReconnectMessage(unreachableURL), wsNotificationMessage)
+		waitForWSClose(conn)
+	})
+	defer server.Close()
+
+	d := newDispatcher(1)
+	handler := NewSubHandler(false, nil)
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {
+		d.Trigger()
+	}
+
+	errs := make(chan error, 1)
+	var disconnects int32
+	client := NewWSClient(handler)
+	client.URL = wsURL(server, "/ws")
+	client.OnError = func(err error) {
+		errs <- err
+	}
+	client.OnDisconnected = func(reason error) {
+		atomic.AddInt32(&disconnects, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = client.Run(ctx)
+	}()
+
+	// The old connection is kept after failing to follow the reconnect
+	assert.True(t, d.WaitForTrigger(time.Second), "HandleChannelUpdate failed to trigger on the old connection")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, <-errs, "follow session_reconnect")
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&disconnects))
+}
+
+func TestWSClient_Run_KeepaliveTimeout(t *testing.T) {
+	var connections int32
+	server := newWSTestServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Welcome, then go silent
+			writeWSMessages(conn, strings.Replace(wsWelcomeMessage, `"keepalive_timeout_seconds":10`, `"keepalive_timeout_seconds":1`, 1))
+		} else {
+			writeWSMessages(conn, wsWelcomeMessage)
+		}
+		waitForWSClose(conn)
+	})
+	defer server.Close()
+
+	d := newDispatcher(2)
+	reasons := make(chan error, 2)
+	client := NewWSClient(NewSubHandler(false, nil))
+	client.URL = wsURL(server, "/ws")
+	client.KeepaliveGrace = 100 * time.Millisecond
+	client.MinReconnectDelay = 10 * time.Millisecond
+	client.OnWelcome = func(session *WSSession) {
+		d.Trigger()
+	}
+	client.OnDisconnected = func(reason error) {
+		reasons <- reason
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = client.Run(ctx)
+	}()
+
+	assert.True(t, d.WaitForTrigger(time.Second), "OnWelcome failed to trigger")
+	assert.True(t, d.WaitForTrigger(3*time.Second), "OnWelcome failed to trigger after reconnect")
+	assert.ErrorIs(t, <-reasons, ErrKeepaliveTimeout)
+}
+
+func TestWSClient_reconnectDelay(t *testing.T) {
+	client := &WSClient{
+		MinReconnectDelay: time.Second,
+		MaxReconnectDelay: 10 * time.Second,
+	}
+
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		delay := client.reconnectDelay(attempt)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
+
+func newWSTestServer(t *testing.T, serve func(conn *websocket.Conn)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade websocket: %v", err)
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}))
+}
+
+func writeWSMessages(conn *websocket.Conn, messages ...string) {
+	for _, msg := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			return
+		}
+	}
+}
+
+// waitForWSClose blocks until the client closes the connection.
+func waitForWSClose(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func wsNotificationMessageWithID(id string) string {
+	return strings.Replace(wsNotificationMessage, "befa7b53-d79d-478f-86b9-120f112b044e", id, 1)
+}
+
+func wsReconnectMessage(url string) string {
+	return `{"metadata":{"message_id":"84c1e79a-2a4b-4c13-ba0b-4312293e9308","message_type":"session_reconnect","message_timestamp":"2022-11-18T09:10:11.634234626Z"},"payload":{"session":{"id":"AQoQILE98gtqShGmLD7AM6yJThAB","status":"reconnecting","keepalive_timeout_seconds":null,"reconnect_url":"` + url + `","connected_at":"2022-11-16T10:11:12.634234626Z"}}}`
+}
+
+func wsURL(server *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + path
+}
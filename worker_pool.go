@@ -0,0 +1,179 @@
+package eventsub_framework
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+)
+
+// OverflowPolicy decides what a WorkerPool does with a task when its queue is
+// full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the queue. If the context
+	// of the delivery is done first, such as when the client disconnects,
+	// the message is rejected with a 503 status.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the message with a 503 status so that Twitch
+	// delivers it again later.
+	OverflowReject
+	// OverflowDrop acknowledges the message without handling it and invokes
+	// WorkerPool.OnDrop.
+	OverflowDrop
+)
+
+var (
+	// ErrQueueFull is returned by a WorkerPool with the OverflowReject policy
+	// when its queue is full.
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrPoolClosed is returned by a WorkerPool after Close has been called.
+	ErrPoolClosed = errors.New("worker pool is closed")
+)
+
+// WorkerPoolStats describes the state of a WorkerPool.
+type WorkerPoolStats struct {
+	Workers       int // Number of workers.
+	QueueCapacity int // Maximum number of queued tasks.
+	QueueDepth    int // Number of queued tasks.
+
+	Dispatched   uint64        // Number of tasks started by workers.
+	WaitDuration time.Duration // Total time tasks waited in the queue.
+	Rejected     uint64        // Number of tasks rejected by OverflowReject.
+	Dropped      uint64        // Number of tasks dropped by OverflowDrop.
+}
+
+type queuedTask struct {
+	task     func()
+	queuedAt time.Time
+}
+
+// WorkerPool is a Dispatcher which runs tasks with a fixed number of workers
+// fed by a bounded queue.
+type WorkerPool struct {
+	overflow OverflowPolicy
+	workers  int
+	queue    chan queuedTask
+	done     sync.WaitGroup
+
+	// Called when a task is dropped by the OverflowDrop policy.
+	OnDrop func(h *esb.ResponseHeaders)
+
+	mu     sync.RWMutex
+	closed bool
+	// Closed when Close is called, to stop blocked calls to Dispatch.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	statsMu sync.Mutex
+	stats   WorkerPoolStats
+}
+
+// NewWorkerPool creates a new WorkerPool and starts its workers. The pool
+// queues up to queueSize tasks, after which the overflow policy applies.
+func NewWorkerPool(workers, queueSize int, overflow OverflowPolicy) *WorkerPool {
+	if workers <= 0 {
+		panic("worker count must be positive")
+	}
+
+	p := &WorkerPool{
+		overflow: overflow,
+		workers:  workers,
+		queue:    make(chan queuedTask, queueSize),
+		closing:  make(chan struct{}),
+	}
+
+	p.done.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) work() {
+	defer p.done.Done()
+	for t := range p.queue {
+		wait := time.Since(t.queuedAt)
+		p.statsMu.Lock()
+		p.stats.Dispatched++
+		p.stats.WaitDuration += wait
+		p.statsMu.Unlock()
+
+		t.task()
+	}
+}
+
+// Dispatch queues task to be run by a worker. If the queue is full, the
+// overflow policy of the pool applies.
+func (p *WorkerPool) Dispatch(d *Delivery, task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	t := queuedTask{task: task, queuedAt: time.Now()}
+	if p.overflow == OverflowBlock {
+		select {
+		case p.queue <- t:
+			return nil
+		case <-d.Context().Done():
+			return d.Context().Err()
+		case <-p.closing:
+			return ErrPoolClosed
+		}
+	}
+
+	select {
+	case p.queue <- t:
+		return nil
+	default:
+	}
+
+	if p.overflow == OverflowDrop {
+		p.statsMu.Lock()
+		p.stats.Dropped++
+		p.statsMu.Unlock()
+		if p.OnDrop != nil {
+			p.OnDrop(d.Headers)
+		}
+		return ErrTaskDropped
+	}
+
+	p.statsMu.Lock()
+	p.stats.Rejected++
+	p.statsMu.Unlock()
+	return ErrQueueFull
+}
+
+// Stats returns the current statistics of the pool.
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	p.statsMu.Lock()
+	stats := p.stats
+	p.statsMu.Unlock()
+
+	stats.Workers = p.workers
+	stats.QueueCapacity = cap(p.queue)
+	stats.QueueDepth = len(p.queue)
+	return stats
+}
+
+// Close stops accepting tasks and waits for queued tasks to finish. Call
+// SubHandler.Shutdown before Close so that no messages are rejected.
+func (p *WorkerPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+	})
+
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	p.done.Wait()
+}
@@ -0,0 +1,165 @@
+package eventsub_framework
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	esb "github.com/dnsge/twitch-eventsub-bindings"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBlockedPoolHandler returns a SubHandler using pool whose channel.update
+// handler blocks until release is closed. The returned dispatcher is
+// triggered when a handler starts.
+func newBlockedPoolHandler(pool *WorkerPool, release chan struct{}) (*SubHandler, dispatcher) {
+	started := newDispatcher(1)
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.Dispatcher = pool
+	On(handler.Registry, "channel.update", "1", func(ctx context.Context, d *Delivery, event *esb.EventChannelUpdate) error {
+		started.Trigger()
+		<-release
+		return nil
+	})
+	return handler, started
+}
+
+func TestWorkerPool_Reject(t *testing.T) {
+	pool := NewWorkerPool(1, 1, OverflowReject)
+	release := make(chan struct{})
+	handler, started := newBlockedPoolHandler(pool, release)
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	// Queued behind the running handler
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+
+	// Rejected so that Twitch retries
+	res = handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	stats := pool.Stats()
+	assert.Equal(t, 1, stats.QueueDepth)
+	assert.Equal(t, uint64(1), stats.Rejected)
+
+	close(release)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	pool.Close()
+
+	stats = pool.Stats()
+	assert.Equal(t, 0, stats.QueueDepth)
+	assert.Equal(t, uint64(2), stats.Dispatched)
+}
+
+func TestWorkerPool_Drop(t *testing.T) {
+	pool := NewWorkerPool(1, 1, OverflowDrop)
+	release := make(chan struct{})
+	handler, started := newBlockedPoolHandler(pool, release)
+
+	var dropped *esb.ResponseHeaders
+	pool.OnDrop = func(h *esb.ResponseHeaders) {
+		dropped = h
+	}
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+
+	// Dropped, but still acknowledged
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	if assert.NotNil(t, dropped) {
+		assert.Equal(t, "channel.update", dropped.SubscriptionType)
+	}
+	assert.Equal(t, uint64(1), pool.Stats().Dropped)
+
+	close(release)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	pool.Close()
+}
+
+func TestWorkerPool_Closed(t *testing.T) {
+	pool := NewWorkerPool(1, 1, OverflowBlock)
+	pool.Close()
+
+	handler := NewSubHandler(false, nil)
+	handler.Clock = clockAt(testTime)
+	handler.Dispatcher = pool
+	handler.HandleChannelUpdate = func(h *esb.ResponseHeaders, event *esb.EventChannelUpdate) {}
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestWorkerPool_BlockCancelled(t *testing.T) {
+	pool := NewWorkerPool(1, 1, OverflowBlock)
+	release := make(chan struct{})
+	handler, started := newBlockedPoolHandler(pool, release)
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+
+	// Blocked on the full queue until the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res = handleRequest(handler, func() *http.Request {
+		return newNotificationRequest().WithContext(ctx)
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	close(release)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	pool.Close()
+	assert.Equal(t, uint64(2), pool.Stats().Dispatched)
+}
+
+func TestWorkerPool_CallbacksBypassPool(t *testing.T) {
+	pool := NewWorkerPool(1, 1, OverflowDrop)
+	release := make(chan struct{})
+	handler, started := newBlockedPoolHandler(pool, release)
+
+	var dropped int
+	pool.OnDrop = func(h *esb.ResponseHeaders) {
+		dropped++
+	}
+
+	res := handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, started.WaitForTrigger(100*time.Millisecond), "handler failed to start")
+	res = handleRequest(handler, newNotificationRequest)
+	assert.True(t, isOK(res.StatusCode))
+
+	// The pool is full, but revocations and duplicates are still handled
+	called := newDispatcher(2)
+	handler.OnRevocation = func(h *esb.ResponseHeaders, sub *esb.Subscription, reason Status) {
+		called.Trigger()
+	}
+	handler.IDTracker = NewMapTracker()
+	handler.OnDuplicateNotification = func(h *esb.ResponseHeaders) {
+		called.Trigger()
+	}
+
+	res = handleRequest(handler, newRevocationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, called.WaitForTrigger(100*time.Millisecond), "OnRevocation failed to trigger")
+	res = handleRequest(handler, newRevocationRequest)
+	assert.True(t, isOK(res.StatusCode))
+	assert.True(t, called.WaitForTrigger(100*time.Millisecond), "OnDuplicateNotification failed to trigger")
+	assert.Zero(t, dropped)
+
+	close(release)
+	assert.NoError(t, handler.Shutdown(context.Background()))
+	pool.Close()
+}